@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// BundleAsset is an asset in a bundle, with the rendered HTML of components
+type BundleAsset struct {
+	ID     AssetKey `json:"id"`
+	Source string   `json:"source"`
+	HTML   string   `json:"html"`
+}
+
+// ExportBundle writes every asset in a store to w as a JSON array, the format
+// the browser playground loads
+func ExportBundle(store AssetStore, w io.Writer) error {
+	snapshot, err := store.TakeSnapshot()
+	if err != nil {
+		return err
+	}
+
+	bundle := []BundleAsset{}
+	for _, asset := range snapshot.Assets {
+		entry := BundleAsset{
+			ID:     asset.ID,
+			Source: asset.Source,
+		}
+		if asset.ID.AssetType == ComponentType {
+			component, err := snapshot.Get(asset.ID)
+			if err != nil {
+				return err
+			}
+			buffer := new(bytes.Buffer)
+			if err := RenderComponent(buffer, component.(Component), snapshot.Get); err != nil {
+				return fmt.Errorf("Rendering %q: %v", asset.ID.Name, err)
+			}
+			entry.HTML = buffer.String()
+		}
+		bundle = append(bundle, entry)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(bundle)
+}
+
+// ImportBundle sets every asset in a bundle read from r. Rendered HTML in the
+// bundle is ignored
+func ImportBundle(store AssetStore, r io.Reader) error {
+	var bundle []BundleAsset
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return fmt.Errorf("Invalid bundle: %v", err)
+	}
+
+	for _, asset := range bundle {
+		if err := store.Set(asset.ID, asset.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
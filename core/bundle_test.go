@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "project/main", "root\n\tnode1")
+	fsWrite(fs, "project/style/root", "class1")
+	fsWrite(fs, "project/style/node1", "class2")
+	store := NewFileStore(fs, "project")
+	defer store.Close()
+
+	buffer := new(bytes.Buffer)
+	if err := ExportBundle(store, buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Test export", func(t *testing.T) {
+		var bundle []BundleAsset
+		if err := json.Unmarshal(buffer.Bytes(), &bundle); err != nil {
+			t.Fatal(err)
+		}
+		if len(bundle) != 3 {
+			t.Fatalf("Got %d assets, want 3", len(bundle))
+		}
+		for _, asset := range bundle {
+			if asset.ID.Name == "main" && !strings.Contains(asset.HTML, `class="class2"`) {
+				t.Errorf("Got HTML %q, want rendered main component", asset.HTML)
+			}
+		}
+	})
+
+	t.Run("Test import", func(t *testing.T) {
+		target := NewFileStore(filesystem.NewMemoryFileSystem(), "")
+		defer target.Close()
+
+		if err := ImportBundle(target, bytes.NewReader(buffer.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		asset, err := target.Get(AssetKey{StyleType, "node1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := asset.(Style).Source; got != "class2" {
+			t.Errorf("Got %q, want %q", got, "class2")
+		}
+	})
+
+	t.Run("Test import www bundle", func(t *testing.T) {
+		file, err := os.Open("../www/export.json")
+		if err != nil {
+			t.Skip(err)
+		}
+		defer file.Close()
+
+		target := NewFileStore(filesystem.NewMemoryFileSystem(), "")
+		defer target.Close()
+		if err := ImportBundle(target, file); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := target.Get(AssetKey{ComponentType, "main"}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Test invalid bundle", func(t *testing.T) {
+		if err := ImportBundle(store, strings.NewReader("{}")); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
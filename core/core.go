@@ -73,29 +73,37 @@ func parseElement(line string) ComponentSourceLine {
 func getDependencyKeys(asset Asset) []AssetKey {
 	distinct := make(map[AssetKey]bool)
 	keys := []AssetKey{}
+
+	// Keys are returned in the order first encountered
+	add := func(key AssetKey) {
+		if !distinct[key] {
+			distinct[key] = true
+			keys = append(keys, key)
+		}
+	}
+
 	switch v := asset.(type) {
 	case Component:
-		distinct[AssetKey{StyleType, v.style}] = true
-		// keys = append(keys, AssetKey{StyleType, v.style})
+		add(AssetKey{StyleType, v.style})
+		if v.tag == "svg" {
+			add(AssetKey{SVGType, v.style})
+		}
 		for _, child := range v.children {
 			for _, childKey := range getDependencyKeys(child) {
-				distinct[childKey] = true
+				add(childKey)
 			}
-			// keys = append(keys, getDependencyKeys(child)...)
 		}
 	case Element:
-		distinct[AssetKey{StyleType, v.style}] = true
-		// keys = append(keys, AssetKey{StyleType, v.style})
+		add(AssetKey{StyleType, v.style})
+		if v.tag == "svg" {
+			add(AssetKey{SVGType, v.style})
+		}
 		for _, child := range v.children {
 			for _, childKey := range getDependencyKeys(child) {
-				distinct[childKey] = true
+				add(childKey)
 			}
-			// keys = append(keys, getDependencyKeys(child)...)
 		}
 	}
-	for k := range distinct {
-		keys = append(keys, k)
-	}
 	return keys
 }
 
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffLine is a line of an edit script, prefixed with ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+	a, b int
+}
+
+// splitLines splits text into lines, without a trailing empty line
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// editScript returns the line edits transforming a into b, using the longest
+// common subsequence of lines
+func editScript(a []string, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	script := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			script = append(script, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+	return script
+}
+
+// UnifiedDiff returns a unified diff of two texts, empty if they are equal
+func UnifiedDiff(fromName string, toName string, from string, to string) string {
+	if from == to {
+		return ""
+	}
+	script := editScript(splitLines(from), splitLines(to))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(script); {
+		// Find the next change
+		for start < len(script) && script[start].kind == ' ' {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+
+		// Extend the hunk until a run of unchanged lines longer than the context
+		end := start
+		for end < len(script) {
+			if script[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].kind == ' ' {
+				run++
+			}
+			if run == len(script) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := end + diffContext
+		if last > len(script) {
+			last = len(script)
+		}
+
+		lenA, lenB := 0, 0
+		for _, line := range script[first:last] {
+			if line.kind != '+' {
+				lenA++
+			}
+			if line.kind != '-' {
+				lenB++
+			}
+		}
+		startA, startB := script[first].a+1, script[first].b+1
+		if lenA == 0 {
+			startA--
+		}
+		if lenB == 0 {
+			startB--
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", startA, lenA, startB, lenB)
+		for _, line := range script[first:last] {
+			fmt.Fprintf(&sb, "%c%s\n", line.kind, line.text)
+		}
+		start = last
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+package core
+
+import "sync/atomic"
+
+// StoreMetrics reports the size of a FileStore, how often its entries were
+// evicted and loaded again, and the change events its subscribers missed by
+// falling behind
+type StoreMetrics struct {
+	Entries     int    `json:"entries"`
+	Capacity    int    `json:"capacity"`
+	Evictions   uint64 `json:"evictions"`
+	Reloads     uint64 `json:"reloads"`
+	Dropped     uint64 `json:"dropped"`
+	Disconnects uint64 `json:"disconnects"`
+}
+
+// SetCapacity limits the number of entries held by the store, zero being
+// unlimited. Past the limit the least recently used entries without
+// subscribers or dependants are evicted, closing their file watches, and
+// loaded again the next time they are requested
+func (c *FileStore) SetCapacity(capacity int) {
+	c.mu.Lock()
+	c.capacity = capacity
+	c.mu.Unlock()
+	c.evict()
+}
+
+// Metrics returns the size of the store, its evictions and dropped events
+func (c *FileStore) Metrics() StoreMetrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return StoreMetrics{
+		Entries:     len(c.entries),
+		Capacity:    c.capacity,
+		Evictions:   c.evictions,
+		Reloads:     c.reloads,
+		Dropped:     atomic.LoadUint64(&c.dropped),
+		Disconnects: atomic.LoadUint64(&c.disconnects),
+	}
+}
+
+// touch marks an entry as the most recently used
+func (c *FileStore) touch(key AssetKey, entry *assetEntry) {
+	c.lruMu.Lock()
+	defer c.lruMu.Unlock()
+	if entry.lru == nil {
+		entry.lru = c.lru.PushFront(key)
+	} else {
+		c.lru.MoveToFront(entry.lru)
+	}
+}
+
+// evict removes least recently used entries until the store is within its
+// capacity, or no more entries can be evicted. It must be called without any
+// entry locked
+func (c *FileStore) evict() {
+	c.mu.RLock()
+	over := len(c.entries) - c.capacity
+	if c.capacity <= 0 {
+		over = 0
+	}
+	c.mu.RUnlock()
+	if over <= 0 {
+		return
+	}
+
+	// Evicting an entry may free its dependencies, so pass over the entries
+	// again while that makes room
+	for evicted := true; over > 0 && evicted; {
+		c.lruMu.Lock()
+		candidates := []AssetKey{}
+		for e := c.lru.Back(); e != nil; e = e.Prev() {
+			candidates = append(candidates, e.Value.(AssetKey))
+		}
+		c.lruMu.Unlock()
+
+		evicted = false
+		for _, key := range candidates {
+			if over == 0 {
+				return
+			}
+			if c.evictEntry(key) {
+				evicted = true
+				over--
+			}
+		}
+	}
+}
+
+// evictEntry removes an entry without subscribers or dependants from the
+// store, reporting whether it was removed
+func (c *FileStore) evictEntry(key AssetKey) bool {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	entry.mu.Lock()
+	if entry.evicted || len(entry.watchers) > 0 || len(entry.dependants) > 0 {
+		entry.mu.Unlock()
+		return false
+	}
+	entry.evicted = true
+	dependencies, stop := entry.dependencies, entry.stop
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.evicted[key] = struct{}{}
+	c.evictions++
+	c.mu.Unlock()
+	entry.mu.Unlock()
+
+	c.lruMu.Lock()
+	if entry.lru != nil {
+		c.lru.Remove(entry.lru)
+	}
+	c.lruMu.Unlock()
+
+	c.renderMu.Lock()
+	delete(c.renders, key)
+	c.renderMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+
+	// Dependencies no longer notify the evicted entry, which may leave them
+	// free to be evicted in turn
+	for _, dependency := range dependencies {
+		c.mu.RLock()
+		dependencyEntry, ok := c.entries[dependency]
+		c.mu.RUnlock()
+		if ok {
+			dependencyEntry.mu.Lock()
+			delete(dependencyEntry.dependants, key)
+			dependencyEntry.mu.Unlock()
+		}
+	}
+	return true
+}
+
+// addDependant records that an entry depends on another, reloading the
+// dependency if it was evicted in the meantime
+func (c *FileStore) addDependant(key AssetKey, dependency *assetEntry, dependant AssetKey) {
+	for {
+		dependency.mu.Lock()
+		if !dependency.evicted {
+			dependency.dependants[dependant] = struct{}{}
+			dependency.mu.Unlock()
+			return
+		}
+		dependency.mu.Unlock()
+
+		var err error
+		if dependency, err = c.getAssetEntry(key); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"scritti/filesystem"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fileWatchFS can only watch single files, counting the watches open
+type fileWatchFS struct {
+	filesystem.FileSystem
+	mu      *sync.Mutex
+	watches map[string]int
+}
+
+func (fs fileWatchFS) WatchTree(root string, done <-chan bool) (<-chan filesystem.Event, error) {
+	return nil, errors.New("Not supported")
+}
+
+func (fs fileWatchFS) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	events, err := fs.FileSystem.Watch(name, done)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	fs.watches[name]++
+	fs.mu.Unlock()
+	go func() {
+		<-done
+		fs.mu.Lock()
+		fs.watches[name]--
+		fs.mu.Unlock()
+	}()
+	return events, nil
+}
+
+func (fs fileWatchFS) open(name string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.watches[name]
+}
+
+func TestFileStoreEviction(t *testing.T) {
+	memory := filesystem.NewMemoryFileSystem()
+	for i := 0; i < 10; i++ {
+		fsWrite(memory, fmt.Sprintf("style/style%d", i), fmt.Sprintf("class%d", i))
+	}
+	fsWrite(memory, "main", "root\n\tstyle1")
+	fsWrite(memory, "style/root", "class1")
+
+	loaded := func(store *FileStore, key AssetKey) bool {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		_, ok := store.entries[key]
+		return ok
+	}
+	style := func(i int) AssetKey {
+		return AssetKey{StyleType, fmt.Sprintf("style%d", i)}
+	}
+
+	t.Run("Test least recently used", func(t *testing.T) {
+		store := NewFileStore(memory, "")
+		defer store.Close()
+		store.SetCapacity(5)
+
+		for i := 0; i < 10; i++ {
+			if _, err := store.Get(style(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		metrics := store.Metrics()
+		if metrics.Entries != 5 || metrics.Evictions != 5 {
+			t.Errorf("Got %+v, want 5 entries and evictions", metrics)
+		}
+		for i := 0; i < 10; i++ {
+			if got, want := loaded(store, style(i)), i >= 5; got != want {
+				t.Errorf("Got %s loaded %v, want %v", style(i).Name, got, want)
+			}
+		}
+
+		// Evicted entries are loaded again when requested
+		asset, err := store.Get(style(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source := asset.(Style).Source; source != "class0" {
+			t.Errorf("Got %q, want %q", source, "class0")
+		}
+		if metrics := store.Metrics(); metrics.Reloads != 1 || metrics.Entries != 5 {
+			t.Errorf("Got %+v, want 1 reload of 5 entries", metrics)
+		}
+	})
+
+	t.Run("Test watched and depended on entries kept", func(t *testing.T) {
+		store := NewFileStore(memory, "")
+		defer store.Close()
+		store.SetCapacity(2)
+		done := make(chan bool)
+		defer close(done)
+
+		if _, err := store.Watch(style(0), done); err != nil {
+			t.Fatal(err)
+		}
+		mainDone := make(chan bool)
+		if _, err := store.Watch(AssetKey{ComponentType, "main"}, mainDone); err != nil {
+			t.Fatal(err)
+		}
+		for i := 2; i < 10; i++ {
+			if _, err := store.Get(style(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, key := range []AssetKey{style(0), style(1), {StyleType, "root"}} {
+			if !loaded(store, key) {
+				t.Errorf("Got %s evicted, want it kept", key.Name)
+			}
+		}
+
+		// Once the component is evicted its styles can be too
+		close(mainDone)
+		deadline := time.Now().Add(time.Second)
+		for loaded(store, AssetKey{ComponentType, "main"}) && time.Now().Before(deadline) {
+			store.SetCapacity(1)
+			time.Sleep(time.Millisecond)
+		}
+		if loaded(store, AssetKey{ComponentType, "main"}) || loaded(store, style(1)) {
+			t.Error("Expected component and its styles evicted")
+		}
+		if !loaded(store, style(0)) {
+			t.Error("Expected watched style kept")
+		}
+	})
+
+	t.Run("Test file watches closed", func(t *testing.T) {
+		fs := fileWatchFS{memory, &sync.Mutex{}, map[string]int{}}
+		store := NewFileStore(fs, "")
+		defer store.Close()
+		store.SetCapacity(1)
+
+		name := "style/style0"
+		if _, err := store.Get(style(0)); err != nil {
+			t.Fatal(err)
+		}
+		if open := fs.open(name); open != 1 {
+			t.Fatalf("Got %d watches, want 1", open)
+		}
+		if _, err := store.Get(style(1)); err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for fs.open(name) != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if open := fs.open(name); open != 0 {
+			t.Errorf("Got %d watches of evicted entry, want 0", open)
+		}
+
+		// Changes made while evicted are seen once loaded again
+		fsWrite(memory, name, "class10")
+		defer fsWrite(memory, name, "class0")
+		asset, err := store.Get(style(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source := asset.(Style).Source; source != "class10" {
+			t.Errorf("Got %q, want %q", source, "class10")
+		}
+	})
+}
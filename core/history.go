@@ -0,0 +1,250 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"scritti/filesystem"
+	"time"
+)
+
+// maxRevisions bounds the revisions kept per asset, oldest are dropped first
+const maxRevisions = 100
+
+// historyPath is the directory revision logs are persisted to, relative to the store
+var historyPath = filepath.Join(".scritti", "history")
+
+// ErrNoRevision is returned when undoing or redoing past the end of an asset's history
+var ErrNoRevision = errors.New("No revision to restore")
+
+// Revision is a saved state of an asset's source
+type Revision struct {
+	ID        int       `json:"id"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author"`
+}
+
+// AssetHistory is the revision log of an asset. Current is the ID of the
+// revision matching the asset source, revisions after it can be redone
+type AssetHistory struct {
+	Revisions []Revision `json:"revisions"`
+	Current   int        `json:"current"`
+	NextID    int        `json:"nextId"`
+	// RestoredBy is the author who undid, redid or reverted to the current
+	// revision, cleared once the asset is next set
+	RestoredBy string `json:"restoredBy,omitempty"`
+}
+
+// clone returns a copy of the log that can be changed without affecting h
+func (h *AssetHistory) clone() *AssetHistory {
+	clone := *h
+	clone.Revisions = append([]Revision{}, h.Revisions...)
+	return &clone
+}
+
+// index returns the position of a revision in the log, or -1
+func (h *AssetHistory) index(id int) int {
+	for i, revision := range h.Revisions {
+		if revision.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// add appends a revision after the current one, discarding any that could
+// have been redone
+func (h *AssetHistory) add(content string, author string) {
+	if i := h.index(h.Current); i >= 0 {
+		h.Revisions = h.Revisions[:i+1]
+	}
+	h.NextID++
+	h.Revisions = append(h.Revisions, Revision{
+		ID:        h.NextID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Author:    author,
+	})
+	h.Current = h.NextID
+	h.RestoredBy = ""
+	if len(h.Revisions) > maxRevisions {
+		h.Revisions = h.Revisions[len(h.Revisions)-maxRevisions:]
+	}
+}
+
+func (c *FileStore) getHistoryPath(key AssetKey) string {
+	return filepath.Join(c.path, historyPath, assetPath[key.AssetType], key.Name+".json")
+}
+
+// loadHistory returns the revision log of an asset, reading it from the file
+// system on first use. Must be called with setMu held
+func (c *FileStore) loadHistory(key AssetKey) (*AssetHistory, error) {
+	if history, ok := c.history[key]; ok {
+		return history, nil
+	}
+
+	history := &AssetHistory{Revisions: []Revision{}}
+
+	file, err := c.fs.Open(c.getHistoryPath(key))
+	switch err.(type) {
+	case nil:
+		defer file.Close()
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, history); err != nil {
+			return nil, err
+		}
+	case *filesystem.FileNotFound:
+	default:
+		return nil, err
+	}
+
+	c.history[key] = history
+	return history, nil
+}
+
+// saveHistory persists the revision log of an asset. Must be called with setMu held
+func (c *FileStore) saveHistory(key AssetKey, history *AssetHistory) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFile(c.fs, c.getHistoryPath(key), data)
+}
+
+// commit writes new Asset content and records it as a revision, first
+// recording the existing content if the Asset has no history yet. The log
+// only changes once both the content and the log are written. Must be
+// called with setMu held
+func (c *FileStore) commit(key AssetKey, content string, author string) error {
+	stored, err := c.loadHistory(key)
+	if err != nil {
+		return err
+	}
+	history := stored.clone()
+
+	if len(history.Revisions) == 0 {
+		if source, err := c.fetchSource(key); err == nil {
+			history.add(source, "")
+		}
+	}
+
+	if err := c.write(key, content); err != nil {
+		return err
+	}
+
+	history.add(content, author)
+	if err := c.saveHistory(key, history); err != nil {
+		return err
+	}
+	*stored = *history
+	return nil
+}
+
+// History returns the revision log of an Asset
+func (c *FileStore) History(key AssetKey) (AssetHistory, error) {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	history, err := c.loadHistory(key)
+	if err != nil {
+		return AssetHistory{}, err
+	}
+
+	result := *history
+	result.Revisions = append([]Revision{}, history.Revisions...)
+	return result, nil
+}
+
+// Revert restores an Asset to the content of a revision, which becomes the
+// current revision. Later revisions are kept until the Asset is next set
+func (c *FileStore) Revert(key AssetKey, revision int) error {
+	return c.RevertAs(key, revision, "")
+}
+
+// RevertAs restores an Asset to the content of a revision, recording the
+// author in its history
+func (c *FileStore) RevertAs(key AssetKey, revision int, author string) error {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	history, err := c.loadHistory(key)
+	if err != nil {
+		return err
+	}
+
+	i := history.index(revision)
+	if i < 0 {
+		return fmt.Errorf("Revision %d of %q not found", revision, key.Name)
+	}
+
+	return c.revert(key, history, i, author)
+}
+
+// revert restores the revision at position i of an Asset's log, which only
+// changes once both the content and the log are written. Must be called with
+// setMu held
+func (c *FileStore) revert(key AssetKey, stored *AssetHistory, i int, author string) error {
+	revision := stored.Revisions[i]
+	log.Printf("Reverting %q to revision %d\n", key.Name, revision.ID)
+	if err := c.write(key, revision.Content); err != nil {
+		return err
+	}
+
+	history := stored.clone()
+	history.Current = revision.ID
+	history.RestoredBy = author
+	if err := c.saveHistory(key, history); err != nil {
+		return err
+	}
+	*stored = *history
+	return nil
+}
+
+// step reverts an Asset to the revision offset from the current one,
+// recording the author in its history
+func (c *FileStore) step(key AssetKey, offset int, author string) (Revision, error) {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	history, err := c.loadHistory(key)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	current := history.index(history.Current)
+	i := current + offset
+	if current < 0 || i < 0 || i >= len(history.Revisions) {
+		return Revision{}, ErrNoRevision
+	}
+
+	return history.Revisions[i], c.revert(key, history, i, author)
+}
+
+// Undo reverts an Asset to the revision before the current one
+func (c *FileStore) Undo(key AssetKey) (Revision, error) {
+	return c.UndoAs(key, "")
+}
+
+// UndoAs reverts an Asset to the revision before the current one, recording
+// the author in its history
+func (c *FileStore) UndoAs(key AssetKey, author string) (Revision, error) {
+	return c.step(key, -1, author)
+}
+
+// Redo restores the revision after the current one, if an Asset was undone
+func (c *FileStore) Redo(key AssetKey) (Revision, error) {
+	return c.RedoAs(key, "")
+}
+
+// RedoAs restores the revision after the current one, recording the author
+// in its history
+func (c *FileStore) RedoAs(key AssetKey, author string) (Revision, error) {
+	return c.step(key, 1, author)
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+)
+
+// historyFailingFS fails to save revision logs while failing is set
+type historyFailingFS struct {
+	filesystem.FileSystem
+	failing *bool
+}
+
+func (fs historyFailingFS) Rename(oldname string, newname string) error {
+	if *fs.failing && strings.HasPrefix(newname, filepath.Join(".scritti", "history")) {
+		return errors.New("Disk full")
+	}
+	return fs.FileSystem.Rename(oldname, newname)
+}
+
+func TestFileStoreHistory(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "style/root", "class1")
+	key := AssetKey{StyleType, "root"}
+
+	source := func() string {
+		file, err := fs.Open("style/root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 64)
+		n, _ := file.Read(data)
+		return string(data[:n])
+	}
+
+	store := NewFileStore(fs, "")
+	defer store.Close()
+	store.SetAs(key, "class2", "alice")
+	store.SetAs(key, "class3", "bob")
+
+	t.Run("Test history records revisions", func(t *testing.T) {
+		history, err := store.History(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Revisions) != 3 {
+			t.Fatalf("Got %d revisions, want 3", len(history.Revisions))
+		}
+		if history.Revisions[0].Content != "class1" || history.Revisions[2].Author != "bob" {
+			t.Errorf("Got %+v, want original content then authored revisions", history.Revisions)
+		}
+	})
+
+	t.Run("Test undo and redo", func(t *testing.T) {
+		if _, err := store.Undo(key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Undo(key); err != nil {
+			t.Fatal(err)
+		}
+		if got := source(); got != "class1" {
+			t.Errorf("Got %q, want %q", got, "class1")
+		}
+		if _, err := store.Undo(key); err != ErrNoRevision {
+			t.Errorf("Got %v, want %v", err, ErrNoRevision)
+		}
+
+		if _, err := store.Redo(key); err != nil {
+			t.Fatal(err)
+		}
+		if got := source(); got != "class2" {
+			t.Errorf("Got %q, want %q", got, "class2")
+		}
+	})
+
+	t.Run("Test undo and redo record the author", func(t *testing.T) {
+		if _, err := store.UndoAs(key, "carol"); err != nil {
+			t.Fatal(err)
+		}
+		history, _ := store.History(key)
+		if history.RestoredBy != "carol" {
+			t.Errorf("Got %q, want %q", history.RestoredBy, "carol")
+		}
+		if _, err := store.RedoAs(key, "dave"); err != nil {
+			t.Fatal(err)
+		}
+		history, _ = store.History(key)
+		if history.RestoredBy != "dave" {
+			t.Errorf("Got %q, want %q", history.RestoredBy, "dave")
+		}
+	})
+
+	t.Run("Test set discards redo", func(t *testing.T) {
+		store.Set(key, "class4")
+		if _, err := store.Redo(key); err != ErrNoRevision {
+			t.Errorf("Got %v, want %v", err, ErrNoRevision)
+		}
+	})
+
+	t.Run("Test history persists", func(t *testing.T) {
+		reopened := NewFileStore(fs, "")
+		defer reopened.Close()
+
+		history, err := reopened.History(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Revisions) != 3 {
+			t.Errorf("Got %d revisions, want 3", len(history.Revisions))
+		}
+
+		if err := reopened.Revert(key, history.Revisions[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := source(); got != "class1" {
+			t.Errorf("Got %q, want %q", got, "class1")
+		}
+	})
+
+	t.Run("Test failed saves leave history unchanged", func(t *testing.T) {
+		failing := false
+		memory := filesystem.NewMemoryFileSystem()
+		fsWrite(memory, "style/root", "class1")
+		store := NewFileStore(historyFailingFS{memory, &failing}, "")
+		defer store.Close()
+		store.SetAs(key, "class2", "alice")
+
+		failing = true
+		if err := store.SetAs(key, "class3", "bob"); err == nil {
+			t.Error("Expected error saving history")
+		}
+		if _, err := store.UndoAs(key, "bob"); err == nil {
+			t.Error("Expected error saving history")
+		}
+
+		history, _ := store.History(key)
+		if len(history.Revisions) != 2 || history.Current != history.Revisions[1].ID || history.RestoredBy != "" {
+			t.Errorf("Got %+v, want the 2 saved revisions with the last current", history)
+		}
+	})
+
+	t.Run("Test history is bounded", func(t *testing.T) {
+		for i := 0; i < maxRevisions+10; i++ {
+			store.Set(key, "class")
+		}
+		history, _ := store.History(key)
+		if len(history.Revisions) != maxRevisions {
+			t.Errorf("Got %d revisions, want %d", len(history.Revisions), maxRevisions)
+		}
+	})
+}
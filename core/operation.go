@@ -0,0 +1,264 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Op is a single step of an Operation, exactly one field is set.
+// Lengths are counted in runes
+type Op struct {
+	Retain int    `json:"retain,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Delete int    `json:"delete,omitempty"`
+}
+
+// Operation is a sequence of retain, insert and delete steps spanning an
+// entire text document
+type Operation []Op
+
+// maxInt is the largest int, bounding the lengths an Operation may span
+const maxInt = int(^uint(0) >> 1)
+
+// ErrOperationLength is returned when an Operation doesn't span the text it is applied to
+var ErrOperationLength = errors.New("Operation length does not match document length")
+
+// NewReplaceOperation returns an Operation transforming source into target,
+// replacing the text between their common prefix and suffix
+func NewReplaceOperation(source string, target string) Operation {
+	a, b := []rune(source), []rune(target)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var o Operation
+	o = o.retain(prefix)
+	o = o.delete(len(a) - prefix - suffix)
+	o = o.insert(string(b[prefix : len(b)-suffix]))
+	o = o.retain(suffix)
+	return o
+}
+
+// retain appends a retain step, merging with a trailing retain
+func (o Operation) retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Op{Retain: n})
+}
+
+// insert appends an insert step, keeping inserts ahead of adjacent deletes
+func (o Operation) insert(s string) Operation {
+	if len(s) == 0 {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && len(o[last].Insert) > 0 {
+		o[last].Insert += s
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		if last > 0 && len(o[last-1].Insert) > 0 {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Op{Insert: s}
+		return o
+	}
+	return append(o, Op{Insert: s})
+}
+
+// delete appends a delete step, merging with a trailing delete
+func (o Operation) delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Op{Delete: n})
+}
+
+// validate checks each step sets exactly one positive field, and that the
+// lengths spanned fit in an int
+func (o Operation) validate() error {
+	base, target := 0, 0
+	for _, op := range o {
+		set := 0
+		if op.Retain != 0 {
+			set++
+		}
+		if len(op.Insert) > 0 {
+			set++
+		}
+		if op.Delete != 0 {
+			set++
+		}
+		if set != 1 || op.Retain < 0 || op.Delete < 0 {
+			return fmt.Errorf("Invalid operation step %+v", op)
+		}
+		if op.Retain+op.Delete > maxInt-base || op.Retain+len(op.Insert) > maxInt-target {
+			return ErrOperationLength
+		}
+		base += op.Retain + op.Delete
+		target += op.Retain + len(op.Insert)
+	}
+	return nil
+}
+
+// BaseLength returns the length of the text an Operation applies to
+func (o Operation) BaseLength() int {
+	n := 0
+	for _, op := range o {
+		n += op.Retain + op.Delete
+	}
+	return n
+}
+
+// TargetLength returns the length of the text an Operation produces
+func (o Operation) TargetLength() int {
+	n := 0
+	for _, op := range o {
+		n += op.Retain + len([]rune(op.Insert))
+	}
+	return n
+}
+
+// Apply returns the result of applying an Operation to text
+func (o Operation) Apply(text string) (string, error) {
+	if err := o.validate(); err != nil {
+		return "", err
+	}
+	source := []rune(text)
+
+	// Each step is checked against the text remaining, so lengths from
+	// clients never index past the end
+	result := make([]rune, 0, len(source))
+	i := 0
+	for _, op := range o {
+		switch {
+		case op.Retain > 0:
+			if op.Retain > len(source)-i {
+				return "", ErrOperationLength
+			}
+			result = append(result, source[i:i+op.Retain]...)
+			i += op.Retain
+		case len(op.Insert) > 0:
+			result = append(result, []rune(op.Insert)...)
+		case op.Delete > 0:
+			if op.Delete > len(source)-i {
+				return "", ErrOperationLength
+			}
+			i += op.Delete
+		}
+	}
+	if i != len(source) {
+		return "", ErrOperationLength
+	}
+	return string(result), nil
+}
+
+// Transform takes two concurrent Operations a and b applying to the same text,
+// returning a' and b' such that applying a then b' is equivalent to applying
+// b then a'. Where both insert at the same position, a's insert comes first
+func Transform(a Operation, b Operation) (Operation, Operation, error) {
+	if err := a.validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := b.validate(); err != nil {
+		return nil, nil, err
+	}
+	if a.BaseLength() != b.BaseLength() {
+		return nil, nil, ErrOperationLength
+	}
+
+	var aPrime, bPrime Operation
+	i, j := 0, 0
+	var opA, opB *Op
+
+	next := func(o Operation, k *int) *Op {
+		if *k >= len(o) {
+			return nil
+		}
+		op := o[*k]
+		*k++
+		return &op
+	}
+	opA, opB = next(a, &i), next(b, &j)
+
+	for opA != nil || opB != nil {
+		// Inserts are carried over, retaining over them in the other operation
+		if opA != nil && len(opA.Insert) > 0 {
+			aPrime = aPrime.insert(opA.Insert)
+			bPrime = bPrime.retain(len([]rune(opA.Insert)))
+			opA = next(a, &i)
+			continue
+		}
+		if opB != nil && len(opB.Insert) > 0 {
+			aPrime = aPrime.retain(len([]rune(opB.Insert)))
+			bPrime = bPrime.insert(opB.Insert)
+			opB = next(b, &j)
+			continue
+		}
+		if opA == nil || opB == nil {
+			return nil, nil, ErrOperationLength
+		}
+
+		// Both steps now retain or delete, consume the shorter span
+		lenA, lenB := opA.Retain+opA.Delete, opB.Retain+opB.Delete
+		n := lenA
+		if lenB < n {
+			n = lenB
+		}
+
+		switch {
+		case opA.Retain > 0 && opB.Retain > 0:
+			aPrime = aPrime.retain(n)
+			bPrime = bPrime.retain(n)
+		case opA.Delete > 0 && opB.Retain > 0:
+			aPrime = aPrime.delete(n)
+		case opA.Retain > 0 && opB.Delete > 0:
+			bPrime = bPrime.delete(n)
+		}
+		// Where both delete the same span, neither needs to
+
+		opA = consume(opA, n)
+		opB = consume(opB, n)
+		if opA == nil {
+			opA = next(a, &i)
+		}
+		if opB == nil {
+			opB = next(b, &j)
+		}
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// consume shortens a retain or delete step by n, returning nil once exhausted
+func consume(op *Op, n int) *Op {
+	if op.Retain > 0 {
+		op.Retain -= n
+		if op.Retain == 0 {
+			return nil
+		}
+		return op
+	}
+	op.Delete -= n
+	if op.Delete == 0 {
+		return nil
+	}
+	return op
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestOperationApply(t *testing.T) {
+	t.Run("Test apply retain, insert, delete", func(t *testing.T) {
+		o := Operation{{Retain: 4}, {Insert: "\n\tchild"}, {Delete: 6}}
+		got, err := o.Apply("root\n\told!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "root\n\tchild"; got != want {
+			t.Errorf("Got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Test apply length mismatch", func(t *testing.T) {
+		o := Operation{{Retain: 2}}
+		if _, err := o.Apply("abc"); err != ErrOperationLength {
+			t.Errorf("Got %v, want %v", err, ErrOperationLength)
+		}
+	})
+
+	t.Run("Test apply invalid step", func(t *testing.T) {
+		o := Operation{{Retain: 1, Delete: 1}}
+		if _, err := o.Apply("ab"); err == nil {
+			t.Error("Expected error")
+		}
+		o = Operation{{Delete: -1}, {Retain: 3}}
+		if _, err := o.Apply("ab"); err == nil {
+			t.Error("Expected error for a negative count")
+		}
+	})
+
+	t.Run("Test apply overflowing lengths", func(t *testing.T) {
+		for _, o := range []Operation{
+			{{Retain: maxInt}, {Retain: maxInt}, {Retain: 5}},
+			{{Insert: "x"}, {Retain: maxInt - 1}},
+			{{Retain: 1}, {Delete: maxInt}},
+		} {
+			if _, err := o.Apply("abc"); err != ErrOperationLength {
+				t.Errorf("Got %v applying %+v, want %v", err, o, ErrOperationLength)
+			}
+		}
+	})
+}
+
+func TestNewReplaceOperation(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "abc"},
+		{"abc", ""},
+		{"root\n\tnode1", "root\n\tnode2"},
+		{"héllo wörld", "héllo there wörld"},
+		{"aaaa", "aa"},
+	}
+
+	for _, c := range cases {
+		o := NewReplaceOperation(c[0], c[1])
+		got, err := o.Apply(c[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c[1] {
+			t.Errorf("Got %q, want %q", got, c[1])
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	t.Run("Test concurrent inserts at same position", func(t *testing.T) {
+		a := Operation{{Retain: 4}, {Insert: "A"}}
+		b := Operation{{Retain: 4}, {Insert: "B"}}
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		left, _ := a.Apply("root")
+		left, _ = bPrime.Apply(left)
+		right, _ := b.Apply("root")
+		right, _ = aPrime.Apply(right)
+
+		if want := "rootAB"; left != want || right != want {
+			t.Errorf("Got %q and %q, want %q", left, right, want)
+		}
+	})
+
+	t.Run("Test random concurrent edits converge", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 500; i++ {
+			source := randomText(r, 20)
+			a := NewReplaceOperation(source, randomEdit(r, source))
+			b := NewReplaceOperation(source, randomEdit(r, source))
+
+			aPrime, bPrime, err := Transform(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			left, _ := a.Apply(source)
+			left, err = bPrime.Apply(left)
+			if err != nil {
+				t.Fatal(err)
+			}
+			right, _ := b.Apply(source)
+			right, err = aPrime.Apply(right)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if left != right {
+				t.Fatalf("Edits %v and %v of %q diverged, got %q and %q", a, b, source, left, right)
+			}
+		}
+	})
+}
+
+func randomText(r *rand.Rand, n int) string {
+	letters := []rune("ab\tñ\n")
+	text := make([]rune, r.Intn(n))
+	for i := range text {
+		text[i] = letters[r.Intn(len(letters))]
+	}
+	return string(text)
+}
+
+func randomEdit(r *rand.Rand, source string) string {
+	text := []rune(source)
+	start := r.Intn(len(text) + 1)
+	end := start + r.Intn(len(text)-start+1)
+	return string(text[:start]) + randomText(r, 5) + string(text[end:])
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// LoadMode chooses when a FileStore loads the assets of a project
+type LoadMode int
+
+// LoadMode enum
+const (
+	// Lazy loads each asset the first time it is requested
+	Lazy LoadMode = iota
+	// Eager loads every asset up front with Preload
+	Eager
+)
+
+// ParseLoadMode returns the LoadMode named "lazy" or "eager"
+func ParseLoadMode(name string) (LoadMode, error) {
+	switch name {
+	case "lazy":
+		return Lazy, nil
+	case "eager":
+		return Eager, nil
+	}
+	return Lazy, fmt.Errorf("Unknown load mode %q, want lazy or eager", name)
+}
+
+func (m LoadMode) String() string {
+	if m == Eager {
+		return "eager"
+	}
+	return "lazy"
+}
+
+// LoadError reports an asset that failed to load or parse
+type LoadError struct {
+	Key AssetKey
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("Can't load [%d] %s: %v", e.Key.AssetType, e.Key.Name, e.Err)
+}
+
+// Preload loads and parses every asset in the project using a pool of
+// workers, one per CPU if workers isn't positive. Progress is reported after
+// each asset, from a single goroutine. Assets failing to load don't stop the
+// others, their errors are returned sorted by asset
+func (c *FileStore) Preload(workers int, progress func(loaded int, total int)) ([]*LoadError, error) {
+	keys, err := c.Scan()
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	pending := make(chan AssetKey)
+	results := make(chan *LoadError)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for key := range pending {
+				var result *LoadError
+				if _, err := c.getAssetEntry(key); err != nil {
+					result = &LoadError{key, err}
+				}
+				c.evict()
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		for _, key := range keys {
+			pending <- key
+		}
+		close(pending)
+		wg.Wait()
+		close(results)
+	}()
+
+	diagnostics := []*LoadError{}
+	loaded := 0
+	for result := range results {
+		loaded++
+		if result != nil {
+			diagnostics = append(diagnostics, result)
+		}
+		if progress != nil {
+			progress(loaded, len(keys))
+		}
+	}
+
+	sort.Slice(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Key, diagnostics[j].Key
+		if a.AssetType != b.AssetType {
+			return a.AssetType < b.AssetType
+		}
+		return a.Name < b.Name
+	})
+	return diagnostics, nil
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"scritti/filesystem"
+	"testing"
+)
+
+// unreadableFS fails to open a single file
+type unreadableFS struct {
+	filesystem.FileSystem
+	name string
+}
+
+func (fs unreadableFS) Open(name string) (filesystem.File, error) {
+	if name == fs.name {
+		return nil, errors.New("Permission denied")
+	}
+	return fs.FileSystem.Open(name)
+}
+
+func TestFileStorePreload(t *testing.T) {
+	memory := filesystem.NewMemoryFileSystem()
+	for i := 0; i < 20; i++ {
+		fsWrite(memory, fmt.Sprintf("component%d", i), fmt.Sprintf("root\n\tstyle%d", i%5))
+	}
+	for i := 0; i < 5; i++ {
+		fsWrite(memory, fmt.Sprintf("style/style%d", i), "class1\nclass2")
+	}
+	fsWrite(memory, "style/root", "class1")
+	fsWrite(memory, "broken", "root")
+
+	t.Run("Test preload", func(t *testing.T) {
+		store := NewFileStore(unreadableFS{memory, "broken"}, "")
+		defer store.Close()
+
+		calls, last := 0, 0
+		diagnostics, err := store.Preload(4, func(loaded int, total int) {
+			calls++
+			if loaded != last+1 || total != 27 {
+				t.Errorf("Got progress %d of %d after %d", loaded, total, last)
+			}
+			last = loaded
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 27 {
+			t.Errorf("Got %d progress reports, want 27", calls)
+		}
+
+		if len(diagnostics) != 1 || diagnostics[0].Key != (AssetKey{ComponentType, "broken"}) {
+			t.Fatalf("Got %v, want the broken asset only", diagnostics)
+		}
+		if got := len(store.List()); got != 26 {
+			t.Errorf("Got %d loaded assets, want 26", got)
+		}
+
+		// Shared styles know every component depending on them
+		entry, err := store.getAssetEntry(AssetKey{StyleType, "style0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.mu.RLock()
+		dependants := len(entry.dependants)
+		entry.mu.RUnlock()
+		if dependants != 4 {
+			t.Errorf("Got %d dependants, want 4", dependants)
+		}
+	})
+
+	t.Run("Test load mode", func(t *testing.T) {
+		for _, mode := range []LoadMode{Lazy, Eager} {
+			if got, err := ParseLoadMode(mode.String()); err != nil || got != mode {
+				t.Errorf("Got %v %v, want %v", got, err, mode)
+			}
+		}
+		if _, err := ParseLoadMode("sometimes"); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// renderEntry is a cached render of a Component, along with the version of
+// every asset read while rendering it
+type renderEntry struct {
+	html     string
+	hash     string
+	versions map[AssetKey]string
+}
+
+// Render returns the HTML of a Component and a hash of the versions of every
+// asset rendered, changing with the HTML. Renders are cached until the
+// Component or any asset it renders changes
+func (c *FileStore) Render(key AssetKey) (string, string, error) {
+	c.renderMu.Lock()
+	cached, ok := c.renders[key]
+	c.renderMu.Unlock()
+	if ok && c.currentRender(cached) {
+		return cached.html, cached.hash, nil
+	}
+
+	asset, version, err := c.GetVersion(key)
+	if err != nil {
+		return "", "", err
+	}
+	component, ok := asset.(Component)
+	if !ok {
+		return "", "", fmt.Errorf("Can't render %d %q", key.AssetType, key.Name)
+	}
+
+	// Hash the version of every asset read while rendering, in the order
+	// the render reads them
+	entry := &renderEntry{versions: map[AssetKey]string{key: version}}
+	hash := sha256.New()
+	io.WriteString(hash, version)
+	get := func(key AssetKey) (Asset, error) {
+		asset, version, err := c.GetVersion(key)
+		entry.versions[key] = version
+		if err == nil {
+			fmt.Fprintf(hash, "\n%d %s %s", key.AssetType, key.Name, version)
+		}
+		return asset, err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := RenderComponent(buffer, component, get); err != nil {
+		return "", "", err
+	}
+	entry.html = buffer.String()
+	entry.hash = fmt.Sprintf("%x", hash.Sum(nil))
+
+	c.renderMu.Lock()
+	c.renders[key] = entry
+	c.renderMu.Unlock()
+	return entry.html, entry.hash, nil
+}
+
+// currentRender reports whether every asset of a cached render is still at
+// the version rendered, catching changes made while it was rendering
+func (c *FileStore) currentRender(entry *renderEntry) bool {
+	for key, version := range entry.versions {
+		if c.entryVersion(key) != version {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidateRender drops the cached renders of an asset and every asset
+// depending on it, directly or not
+func (c *FileStore) invalidateRender(key AssetKey) {
+	visited := map[AssetKey]bool{}
+	pending := []AssetKey{key}
+	for len(pending) > 0 {
+		key, pending = pending[0], pending[1:]
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		c.renderMu.Lock()
+		delete(c.renders, key)
+		c.renderMu.Unlock()
+
+		c.mu.RLock()
+		entry, ok := c.entries[key]
+		c.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		entry.mu.RLock()
+		for dependant := range entry.dependants {
+			pending = append(pending, dependant)
+		}
+		entry.mu.RUnlock()
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreRender(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "main", "root\n\tsvg.icon\n\tchild")
+	fsWrite(fs, "style/root", "class1")
+	fsWrite(fs, "style/icon", "class2")
+	fsWrite(fs, "style/child", "class3")
+	fsWrite(fs, "svg/icon", `<svg viewBox="0 0 20 20"><path d="0"/></svg>`)
+	store := NewFileStore(fs, "")
+	defer store.Close()
+	key := AssetKey{ComponentType, "main"}
+
+	render := func(t *testing.T) (string, string) {
+		t.Helper()
+		html, hash, err := store.Render(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return html, hash
+	}
+	cached := func() bool {
+		store.renderMu.Lock()
+		defer store.renderMu.Unlock()
+		_, ok := store.renders[key]
+		return ok
+	}
+
+	t.Run("Test cached render", func(t *testing.T) {
+		html, hash := render(t)
+		if !cached() {
+			t.Fatal("Expected render to be cached")
+		}
+		if again, againHash := render(t); again != html || againHash != hash {
+			t.Errorf("Got %q %q, want %q %q", again, againHash, html, hash)
+		}
+	})
+
+	// Changing any asset rendered drops the render, which then shows the change
+	for _, tt := range []struct {
+		name    string
+		key     AssetKey
+		content string
+		want    string
+	}{
+		{"Test style change", AssetKey{StyleType, "child"}, "class4", "class4"},
+		{"Test SVG change", AssetKey{SVGType, "icon"}, `<svg viewBox="0 0 20 20"><circle r="1"/></svg>`, "<circle"},
+		{"Test component change", key, "root\n\tchild", `<div class="class1"><div class="class4">`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, before := render(t)
+			if err := store.Set(tt.key, tt.content); err != nil {
+				t.Fatal(err)
+			}
+			if cached() {
+				t.Error("Expected render to be invalidated")
+			}
+			html, hash := render(t)
+			if !strings.Contains(html, tt.want) {
+				t.Errorf("Got %q, want it to contain %q", html, tt.want)
+			}
+			if hash == before {
+				t.Errorf("Got unchanged hash %q", hash)
+			}
+		})
+	}
+
+	t.Run("Test render non-component", func(t *testing.T) {
+		if _, _, err := store.Render(AssetKey{StyleType, "root"}); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
+
+// newLargeStore returns a store holding a component of n elements nested
+// several deep, using styles and SVGs shared between elements
+func newLargeStore(b *testing.B, n int) *FileStore {
+	fs := filesystem.NewMemoryFileSystem()
+	source := new(strings.Builder)
+	source.WriteString("root\n")
+	for i := 0; i < n; i++ {
+		indent := strings.Repeat("\t", 1+i%5)
+		if i%10 == 0 {
+			fmt.Fprintf(source, "%ssvg.icon%d\n", indent, i%20)
+		} else {
+			fmt.Fprintf(source, "%sstyle%d \"Element %d\"\n", indent, i%50, i)
+		}
+	}
+	fsWrite(fs, "main", source.String())
+	fsWrite(fs, "style/root", "class1")
+	for i := 0; i < 50; i++ {
+		fsWrite(fs, fmt.Sprintf("style/style%d", i), fmt.Sprintf("class%d\nshared", i))
+	}
+	for i := 0; i < 20; i++ {
+		fsWrite(fs, fmt.Sprintf("style/icon%d", i), "icon")
+		fsWrite(fs, fmt.Sprintf("svg/icon%d", i), `<svg viewBox="0 0 20 20"><path d="M0 0L20 20"/></svg>`)
+	}
+
+	store := NewFileStore(fs, "")
+	b.Cleanup(func() { store.Close() })
+	if _, _, err := store.Render(AssetKey{ComponentType, "main"}); err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+func BenchmarkRender(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		store := newLargeStore(b, n)
+		asset, err := store.Get(AssetKey{ComponentType, "main"})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("Uncached %d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				buffer := new(bytes.Buffer)
+				if err := RenderComponent(buffer, asset.(Component), store.Get); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Cached %d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := store.Render(AssetKey{ComponentType, "main"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
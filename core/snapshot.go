@@ -0,0 +1,230 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scritti/filesystem"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotPath is the directory snapshots are persisted to, relative to the store
+var snapshotPath = filepath.Join(".scritti", "snapshots")
+
+// AssetSource is the source of an asset at a point in time
+type AssetSource struct {
+	ID     AssetKey `json:"id"`
+	Source string   `json:"source"`
+}
+
+// Snapshot captures the source of every asset in a project. Snapshots taken
+// of the working copy have no name
+type Snapshot struct {
+	Name      string        `json:"name"`
+	Timestamp time.Time     `json:"timestamp"`
+	Assets    []AssetSource `json:"assets"`
+}
+
+// source returns the source of an asset in the snapshot
+func (s Snapshot) source(key AssetKey) (string, bool) {
+	for _, asset := range s.Assets {
+		if asset.ID == key {
+			return asset.Source, true
+		}
+	}
+	return "", false
+}
+
+// Get returns an asset as it was when the snapshot was taken, for use when
+// rendering components of a snapshot
+func (s Snapshot) Get(key AssetKey) (Asset, error) {
+	source, ok := s.source(key)
+	if !ok {
+		return nil, &AssetNotFound{key}
+	}
+	return NewAssetFactory(key.AssetType, source)
+}
+
+// AssetDiff describes the changes to an asset between two snapshots
+type AssetDiff struct {
+	ID     AssetKey `json:"id"`
+	Status string   `json:"status"`
+	Source string   `json:"source"`
+	HTML   string   `json:"html,omitempty"`
+}
+
+// AssetDiff statuses
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// renderLines renders a component of a snapshot to HTML, one tag per line
+func renderLines(s Snapshot, key AssetKey) string {
+	asset, err := s.Get(key)
+	if err != nil {
+		return ""
+	}
+	buffer := new(bytes.Buffer)
+	if err := RenderComponent(buffer, asset.(Component), s.Get); err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(buffer.String(), "><", ">\n<")
+}
+
+// Diff compares two snapshots, returning a unified diff of the source of each
+// changed asset and of the rendered HTML of each changed component
+func Diff(from Snapshot, to Snapshot) []AssetDiff {
+	keys := map[AssetKey]struct{}{}
+	for _, asset := range from.Assets {
+		keys[asset.ID] = struct{}{}
+	}
+	for _, asset := range to.Assets {
+		keys[asset.ID] = struct{}{}
+	}
+
+	sorted := make([]AssetKey, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].AssetType != sorted[j].AssetType {
+			return sorted[i].AssetType < sorted[j].AssetType
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	fromName, toName := from.Name, to.Name
+	if len(toName) == 0 {
+		toName = "working copy"
+	}
+
+	diffs := []AssetDiff{}
+	for _, key := range sorted {
+		a, inFrom := from.source(key)
+		b, inTo := to.source(key)
+
+		diff := AssetDiff{ID: key}
+		switch {
+		case !inFrom:
+			diff.Status = Added
+		case !inTo:
+			diff.Status = Removed
+		default:
+			diff.Status = Modified
+		}
+
+		path := filepath.ToSlash(filepath.Join(assetPath[key.AssetType], key.Name))
+		diff.Source = UnifiedDiff(fromName+"/"+path, toName+"/"+path, a, b)
+
+		// Components also change when any style or SVG they use does
+		if key.AssetType == ComponentType {
+			diff.HTML = UnifiedDiff(fromName+"/"+path+".html", toName+"/"+path+".html", renderLines(from, key), renderLines(to, key))
+		}
+
+		if len(diff.Source) > 0 || len(diff.HTML) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// TakeSnapshot captures the source of every asset in the working copy
+func (c *FileStore) TakeSnapshot() (Snapshot, error) {
+	keys, err := c.Scan()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{
+		Timestamp: time.Now(),
+		Assets:    []AssetSource{},
+	}
+	for _, key := range keys {
+		source, err := c.fetchSource(key)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Assets = append(snapshot.Assets, AssetSource{key, source})
+	}
+	return snapshot, nil
+}
+
+// checkSnapshotName rejects names that are empty, hidden or not a plain file
+// name, so snapshots are never read or written outside the snapshot directory
+func checkSnapshotName(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("Invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+func (c *FileStore) getSnapshotPath(name string) string {
+	return filepath.Join(c.path, snapshotPath, name+".json")
+}
+
+// SaveSnapshot captures the working copy as a named snapshot, replacing any
+// existing snapshot of the same name
+func (c *FileStore) SaveSnapshot(name string) (Snapshot, error) {
+	if err := checkSnapshotName(name); err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot, err := c.TakeSnapshot()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.Name = name
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, filesystem.WriteFile(c.fs, c.getSnapshotPath(name), data)
+}
+
+// LoadSnapshot returns a named snapshot
+func (c *FileStore) LoadSnapshot(name string) (Snapshot, error) {
+	if err := checkSnapshotName(name); err != nil {
+		return Snapshot{}, err
+	}
+
+	file, err := c.fs.Open(c.getSnapshotPath(name))
+	if _, ok := err.(*filesystem.FileNotFound); ok || os.IsNotExist(err) {
+		return Snapshot{}, fmt.Errorf("Snapshot %q not found", name)
+	} else if err != nil {
+		return Snapshot{}, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+// ListSnapshots returns the names of all saved snapshots
+func (c *FileStore) ListSnapshots() ([]string, error) {
+	paths, err := c.fs.List(filepath.Join(c.path, snapshotPath))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, path := range paths {
+		if name := filepath.Base(path); strings.HasSuffix(name, ".json") {
+			names = append(names, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"scritti/filesystem"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("Test equal texts", func(t *testing.T) {
+		if got := UnifiedDiff("a", "b", "root\n", "root\n"); got != "" {
+			t.Errorf("Got %q, want empty diff", got)
+		}
+	})
+
+	t.Run("Test changed line", func(t *testing.T) {
+		want := strings.Join([]string{
+			"--- a",
+			"+++ b",
+			"@@ -1,3 +1,3 @@",
+			" root",
+			"-\tnode1",
+			"+\tnode3",
+			" \tnode2",
+			"",
+		}, "\n")
+		got := UnifiedDiff("a", "b", "root\n\tnode1\n\tnode2", "root\n\tnode3\n\tnode2")
+		if got != want {
+			t.Errorf("Got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Test separate hunks", func(t *testing.T) {
+		from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+		to := "0\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n13"
+		got := UnifiedDiff("a", "b", from, to)
+		if n := strings.Count(got, "@@ -"); n != 2 {
+			t.Errorf("Got %d hunks, want 2\n%s", n, got)
+		}
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "project/main", "root\n\tnode1")
+	fsWrite(fs, "project/style/root", "class1")
+	fsWrite(fs, "project/style/node1", "class2")
+	store := NewFileStore(fs, "project")
+	defer store.Close()
+
+	v1, err := store.SaveSnapshot("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v1.Assets) != 3 {
+		t.Errorf("Got %d assets, want 3", len(v1.Assets))
+	}
+
+	fsWrite(fs, "project/style/node1", "class3")
+	fsWrite(fs, "project/svg/icon", "<svg></svg>")
+
+	t.Run("Test list snapshots", func(t *testing.T) {
+		names, err := store.ListSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != "v1" {
+			t.Errorf("Got %q, want [v1]", names)
+		}
+	})
+
+	t.Run("Test diff against working copy", func(t *testing.T) {
+		from, err := store.LoadSnapshot("v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := store.TakeSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diffs := Diff(from, to)
+		if len(diffs) != 3 {
+			t.Fatalf("Got %d changed assets, want 3: %+v", len(diffs), diffs)
+		}
+
+		// The component source is unchanged, but its rendered HTML is not
+		main := diffs[0]
+		if main.ID != (AssetKey{ComponentType, "main"}) || len(main.Source) > 0 {
+			t.Errorf("Got %+v, want only an HTML diff of main", main)
+		}
+		if !strings.Contains(main.HTML, `+<div class="class3">`) {
+			t.Errorf("Got HTML diff %q, want class3 added", main.HTML)
+		}
+		if diffs[1].Status != Modified || diffs[2].Status != Added {
+			t.Errorf("Got %q and %q, want modified and added", diffs[1].Status, diffs[2].Status)
+		}
+	})
+
+	t.Run("Test invalid snapshot name", func(t *testing.T) {
+		if _, err := store.SaveSnapshot("../v2"); err == nil {
+			t.Error("Expected error")
+		}
+
+		// Other JSON files of the project are not read as snapshots
+		fsWrite(fs, "project/.scritti/config.json", `{"name":"config"}`)
+		if _, err := store.LoadSnapshot("../config"); err == nil || !strings.Contains(err.Error(), "Invalid") {
+			t.Errorf("Got %v, want invalid name error", err)
+		}
+	})
+
+	t.Run("Test load errors", func(t *testing.T) {
+		if _, err := store.LoadSnapshot("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Got %v, want not found error", err)
+		}
+
+		unreadable := NewFileStore(unreadableFS{fs, "project/.scritti/snapshots/v1.json"}, "project")
+		defer unreadable.Close()
+		if _, err := unreadable.LoadSnapshot("v1"); err == nil || strings.Contains(err.Error(), "not found") {
+			t.Errorf("Got %v, want the read error", err)
+		}
+	})
+}
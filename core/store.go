@@ -1,13 +1,14 @@
 package core
 
 import (
-	"bufio"
-	"errors"
+	"container/list"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"path/filepath"
 	"scritti/filesystem"
+	"strings"
 	"sync"
 )
 
@@ -19,6 +20,23 @@ func (e *AssetNotFound) Error() string {
 	return fmt.Sprintf("Asset not found [%d] %s", e.asset.AssetType, e.asset.Name)
 }
 
+// ConflictError is returned by a conditional update when the asset has
+// changed since the version the update was based on
+type ConflictError struct {
+	Key     AssetKey
+	Version string
+	Content string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Asset changed [%d] %s, now at version %s", e.Key.AssetType, e.Key.Name, e.Version)
+}
+
+// ContentVersion returns the version identifying an asset source
+func ContentVersion(source string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+}
+
 // AssetType enum
 type AssetType int
 
@@ -50,14 +68,23 @@ type AssetKey struct {
 	Name      string    `json:"name"`
 }
 
-// assetEntry is the internal representation of an Asset in the store
+// assetEntry is the internal representation of an Asset in the store. Its
+// fields are guarded by mu, except lru which is guarded by the store's lruMu.
+// Entries are locked before the store when both are needed
 type assetEntry struct {
 	asset        Asset
 	dependencies []AssetKey
 	dependants   map[AssetKey]struct{}
 	mu           sync.RWMutex
-	watchers     map[chan AssetEvent]struct{}
+	watchers     map[*assetWatcher]struct{}
 	status       AssetStatus
+	version      string
+	lru          *list.Element
+	stop         chan bool
+	evicted      bool
+
+	// update serializes loading and updating the entry from the file system
+	update sync.Mutex
 }
 
 // newAssetEntry returns a pointer to a new AssetValue instance
@@ -66,17 +93,42 @@ func newAssetEntry() *assetEntry {
 		dependencies: []AssetKey{},
 		dependants:   make(map[AssetKey]struct{}),
 		mu:           sync.RWMutex{},
-		watchers:     make(map[chan AssetEvent]struct{}),
+		watchers:     make(map[*assetWatcher]struct{}),
 		status:       NotLoaded,
 	}
 }
 
+// getStatus returns whether the entry is loaded
+func (e *assetEntry) getStatus() AssetStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.status
+}
+
 // AssetStore provides an interface to retrieve components
 type AssetStore interface {
 	Set(key AssetKey, content string) error
+	SetAs(key AssetKey, content string, author string) error
+	SetIfVersion(key AssetKey, content string, version string) error
+	SetIfVersionAs(key AssetKey, content string, version string, author string) error
 	Get(key AssetKey) (Asset, error)
+	GetVersion(key AssetKey) (Asset, string, error)
 	List() []AssetKey
-	Watch(key AssetKey, done <-chan bool) <-chan AssetEvent
+	Scan() ([]AssetKey, error)
+	History(key AssetKey) (AssetHistory, error)
+	Revert(key AssetKey, revision int) error
+	RevertAs(key AssetKey, revision int, author string) error
+	Undo(key AssetKey) (Revision, error)
+	UndoAs(key AssetKey, author string) (Revision, error)
+	Redo(key AssetKey) (Revision, error)
+	RedoAs(key AssetKey, author string) (Revision, error)
+	TakeSnapshot() (Snapshot, error)
+	SaveSnapshot(name string) (Snapshot, error)
+	LoadSnapshot(name string) (Snapshot, error)
+	ListSnapshots() ([]string, error)
+	Render(key AssetKey) (string, string, error)
+	Metrics() StoreMetrics
+	Watch(key AssetKey, done <-chan bool) (<-chan AssetEvent, error)
 	Close() error
 }
 
@@ -86,18 +138,48 @@ type FileStore struct {
 	fs      filesystem.FileSystem
 	entries map[AssetKey]*assetEntry
 	mu      sync.RWMutex
+	setMu   sync.Mutex
+	history map[AssetKey]*AssetHistory
 	done    chan bool
+	closed  sync.Once
+	tree    bool
+
+	renders  map[AssetKey]*renderEntry
+	renderMu sync.Mutex
+
+	capacity  int
+	lru       *list.List
+	lruMu     sync.Mutex
+	evicted   map[AssetKey]struct{}
+	evictions uint64
+	reloads   uint64
+
+	queueSize   int
+	overflow    OverflowPolicy
+	dropped     uint64
+	disconnects uint64
 }
 
-// NewFileStore returns a new File Store
+// NewFileStore returns a new File Store, following changes to every file in
+// the project. Stores on file systems that can't watch the project as a whole
+// watch each asset once loaded instead
 func NewFileStore(fs filesystem.FileSystem, path string) *FileStore {
-	return &FileStore{
+	store := &FileStore{
 		path:    path,
 		fs:      fs,
 		entries: make(map[AssetKey]*assetEntry),
 		mu:      sync.RWMutex{},
+		history: make(map[AssetKey]*AssetHistory),
 		done:    make(chan bool),
+		renders: make(map[AssetKey]*renderEntry),
+		lru:     list.New(),
+		evicted: make(map[AssetKey]struct{}),
+
+		queueSize: DefaultQueueSize,
+		overflow:  Coalesce,
 	}
+	store.watchTree()
+	return store
 }
 
 var assetPath = map[AssetType]string{
@@ -105,8 +187,8 @@ var assetPath = map[AssetType]string{
 	SVGType:   "svg",
 }
 
-// fetchAsset retrieves an Asset from the file system
-func (c *FileStore) fetchAsset(key AssetKey) (Asset, error) {
+// fetchSource reads the source of an Asset from the file system
+func (c *FileStore) fetchSource(key AssetKey) (string, error) {
 	// Open asset source in file system
 	path := c.getPath(key)
 	log.Printf("Loading asset %q", path)
@@ -117,32 +199,24 @@ func (c *FileStore) fetchAsset(key AssetKey) (Asset, error) {
 		log.Println(err)
 		switch err.(type) {
 		case *filesystem.FileNotFound:
-			return nil, &AssetNotFound{key}
+			return "", &AssetNotFound{key}
 		default:
-			return nil, err
+			return "", err
 		}
 	}
 
 	defer func() {
-		if err = file.Close(); err != nil {
-			log.Fatal(err)
+		if err := file.Close(); err != nil {
+			log.Println(err)
 		}
 	}()
 
 	// Read asset source to buffer
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	source := string(data)
-
-	// Ensure Asset compiles
-	asset, err := NewAssetFactory(key.AssetType, source)
-	if err != nil {
-		return nil, err
-	}
-
-	return asset, nil
+	return string(data), nil
 }
 
 // getAssetEntry returns the internal store representation of an Asset.
@@ -154,14 +228,25 @@ func (c *FileStore) getAssetEntry(key AssetKey) (*assetEntry, error) {
 	c.mu.RUnlock()
 
 	if !ok {
+		// Another caller may have created the entry since it was looked up
 		c.mu.Lock()
-		c.entries[key] = newAssetEntry()
-		assetEntry = c.entries[key]
+		if assetEntry, ok = c.entries[key]; !ok {
+			assetEntry = newAssetEntry()
+			c.entries[key] = assetEntry
+		}
 		c.mu.Unlock()
 	}
 
-	if assetEntry.status == NotLoaded {
-		err := c.loadAssetEntry(key)
+	c.touch(key, assetEntry)
+
+	if assetEntry.getStatus() == NotLoaded {
+		// Load the entry once, callers arriving meanwhile wait for it
+		var err error
+		assetEntry.update.Lock()
+		if assetEntry.getStatus() == NotLoaded {
+			err = c.loadAssetEntry(key, assetEntry)
+		}
+		assetEntry.update.Unlock()
 		// TODO: Check for AssetNotFound error
 		if _, ok := err.(*AssetNotFound); err != nil && !ok {
 			return nil, err
@@ -171,11 +256,41 @@ func (c *FileStore) getAssetEntry(key AssetKey) (*assetEntry, error) {
 	return assetEntry, nil
 }
 
-func (c *FileStore) updateAssetEntry(key AssetKey) error {
+// updateAssetEntry reloads an Asset from the file system, reporting whether
+// its content changed. Unchanged content is neither parsed nor reloaded
+func (c *FileStore) updateAssetEntry(key AssetKey) (bool, error) {
 	// Look up Asset entry
 	assetEntry, err := c.getAssetEntry(key)
 	if err != nil {
-		return err
+		return false, err
+	}
+	return c.updateEntry(key, assetEntry)
+}
+
+// updateEntry reloads an entry from the file system, reporting whether its
+// content changed
+func (c *FileStore) updateEntry(key AssetKey, assetEntry *assetEntry) (bool, error) {
+	assetEntry.update.Lock()
+	defer assetEntry.update.Unlock()
+	return c.refreshEntry(key, assetEntry)
+}
+
+// refreshEntry reloads an entry from the file system and updates the
+// dependants of its dependencies, reporting whether its content changed. Must
+// be called with the entry's update lock held
+func (c *FileStore) refreshEntry(key AssetKey, assetEntry *assetEntry) (bool, error) {
+	// Skip files touched or saved without changes
+	source, err := c.fetchSource(key)
+	if err != nil {
+		return false, err
+	}
+	version := ContentVersion(source)
+	assetEntry.mu.RLock()
+	unchanged := assetEntry.asset != nil && assetEntry.version == version
+	dependencies := assetEntry.dependencies
+	assetEntry.mu.RUnlock()
+	if unchanged {
+		return false, nil
 	}
 
 	// Caclulate dependency changes between current and new asset state
@@ -185,14 +300,14 @@ func (c *FileStore) updateAssetEntry(key AssetKey) error {
 	diff := map[AssetKey]int{}
 
 	// Get current dependencies
-	for _, oldKey := range assetEntry.dependencies {
+	for _, oldKey := range dependencies {
 		diff[oldKey] = -1
 	}
 
-	// Fetch latest Asset version from file system
-	newAsset, err := c.fetchAsset(key)
+	// Ensure Asset compiles
+	newAsset, err := NewAssetFactory(key.AssetType, source)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Get new dependencies
@@ -208,8 +323,10 @@ func (c *FileStore) updateAssetEntry(key AssetKey) error {
 	// Update asset and dependencies
 	assetEntry.mu.Lock()
 	assetEntry.asset = newAsset
+	assetEntry.version = version
 	assetEntry.dependencies = newDependencies
 	assetEntry.mu.Unlock()
+	c.invalidateRender(key)
 
 	var wg sync.WaitGroup
 	wg.Add(len(diff))
@@ -222,12 +339,13 @@ func (c *FileStore) updateAssetEntry(key AssetKey) error {
 				log.Printf("Can't load dependency %q of %q (%s)\n", k.Name, key.Name, err)
 			} else if v == -1 {
 				// Remove old dependant
+				dependency.mu.Lock()
 				delete(dependency.dependants, key)
+				dependency.mu.Unlock()
 			} else if v == 1 {
 				// Add new dependant
 				log.Printf("> Add new dependant %q of %q", k.Name, key.Name)
-				log.Println(dependency, err)
-				dependency.dependants[key] = struct{}{}
+				c.addDependant(k, dependency, key)
 			}
 			wg.Done()
 		}(k, v)
@@ -235,166 +353,412 @@ func (c *FileStore) updateAssetEntry(key AssetKey) error {
 
 	wg.Wait()
 
-	return nil
+	return true, nil
 }
 
-func (c *FileStore) notifyWatchers(key AssetKey) error {
-	assetEntry, err := c.getAssetEntry(key)
-	if err != nil {
-		return nil
+// entryVersion returns the version of a loaded Asset entry, or an empty string
+func (c *FileStore) entryVersion(key AssetKey) string {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return ""
 	}
-	assetEntry.mu.RLock()
-	for watcher := range assetEntry.watchers {
-		log.Printf("Notifying watcher (%q)\n", key.Name)
-		watcher <- AssetEvent{key, true}
-		log.Println("**Notified")
+	entry.mu.RLock()
+	defer entry.mu.RUnlock()
+	if entry.status != Loaded {
+		return ""
 	}
+	return entry.version
+}
 
-	log.Printf("Notifying %d dependants of %s\n", len(assetEntry.dependants), key.Name)
-	for dependant := range assetEntry.dependants {
-		log.Printf("Bubbling change event (%q)\n", dependant.Name)
-		c.notifyWatchers(dependant)
+// notifyWatchers sends a change event to the subscribers of an asset and of
+// every asset depending on it, directly or not. Events are queued for each
+// subscriber, so slow subscribers never hold up the others
+func (c *FileStore) notifyWatchers(key AssetKey) {
+	type delivery struct {
+		watcher *assetWatcher
+		key     AssetKey
+	}
+	deliveries := []delivery{}
+
+	visited := map[AssetKey]bool{}
+	pending := []AssetKey{key}
+	for len(pending) > 0 {
+		k := pending[0]
+		pending = pending[1:]
+		if visited[k] {
+			continue
+		}
+		visited[k] = true
+
+		c.mu.RLock()
+		entry, ok := c.entries[k]
+		c.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		entry.mu.RLock()
+		for watcher := range entry.watchers {
+			deliveries = append(deliveries, delivery{watcher, k})
+		}
+		log.Printf("Notifying %d dependants of %s\n", len(entry.dependants), k.Name)
+		for dependant := range entry.dependants {
+			pending = append(pending, dependant)
+		}
+		entry.mu.RUnlock()
+	}
+
+	for _, d := range deliveries {
+		log.Printf("Notifying watcher (%q)\n", d.key.Name)
+		d.watcher.send(AssetEvent{d.key, d.key == key})
 	}
-	assetEntry.mu.RUnlock()
-	return nil
 }
 
-func (c *FileStore) loadAssetEntry(key AssetKey) error {
+// loadAssetEntry loads an entry from the file system and starts following its
+// changes. Must be called with the entry's update lock held
+func (c *FileStore) loadAssetEntry(key AssetKey, entry *assetEntry) error {
 	log.Printf("Loading asset entry %d-%s", key.AssetType, key.Name)
 
-	// Fetch latest Asset version from file system
-	_, err := c.fetchAsset(key)
-	if err != nil {
+	// Update Asset from the file system
+	if _, err := c.refreshEntry(key, entry); err != nil {
 		return err
 	}
 
-	// Update Asset Entry status
-	c.mu.RLock()
-	c.entries[key].status = Loaded
-	c.mu.RUnlock()
+	// Update Asset Entry status, once its asset is set
+	entry.mu.Lock()
+	entry.status = Loaded
+	entry.mu.Unlock()
+	c.mu.Lock()
+	if _, ok := c.evicted[key]; ok {
+		delete(c.evicted, key)
+		c.reloads++
+	}
+	c.mu.Unlock()
 
-	// Update Asset from the file system
-	err = c.updateAssetEntry(key)
-	if err != nil {
-		return err
+	// Changes are already reported when watching the whole project
+	if c.tree {
+		return nil
 	}
 
-	// Watch for changes to source in the file system
-	watch, err := c.fs.Watch(c.getPath(key), c.done)
+	// Watch for changes to source in the file system until the store is
+	// closed or the entry evicted
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		select {
+		case <-c.done:
+		case <-stop:
+		}
+		close(done)
+	}()
+	watch, err := c.fs.Watch(c.getPath(key), done)
 	if err != nil {
+		close(stop)
 		return err
 	}
+	entry.mu.Lock()
+	entry.stop = stop
+	entry.mu.Unlock()
 
 	// When source changes, update asset entry and notify subscribers
 	go func() {
 		for range watch {
 			log.Printf("Detected change in %q\n", c.getPath(key))
 
-			// Notify any watchers subscribed to the asset
-			c.updateAssetEntry(key)
-			c.notifyWatchers(key)
+			// Notify any watchers subscribed to the asset of changed content
+			if changed, err := c.updateEntry(key, entry); err != nil {
+				log.Println(err)
+			} else if changed {
+				c.notifyWatchers(key)
+			}
 		}
 	}()
 
 	return nil
 }
 
+// watchTree follows changes to every file in the project, if the file system
+// can watch it
+func (c *FileStore) watchTree() {
+	events, err := c.fs.WatchTree(c.path, c.done)
+	if err != nil {
+		log.Printf("Watching assets individually (%s)\n", err)
+		return
+	}
+	c.tree = true
+
+	go func() {
+		for event := range events {
+			if key, ok := c.getKey(event.Name); ok {
+				log.Printf("Detected %s %q\n", event.Op, event.Name)
+				c.applyEvent(key, event.Op)
+			}
+		}
+	}()
+}
+
+// applyEvent updates the entry of an asset changed in the file system and
+// notifies its subscribers. New assets are loaded so they appear in List
+func (c *FileStore) applyEvent(key AssetKey, op filesystem.Op) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	switch op {
+	case filesystem.Created, filesystem.Modified:
+		if ok && entry.getStatus() == Loaded {
+			changed, err := c.updateEntry(key, entry)
+			if err != nil {
+				log.Println(err)
+			}
+			if !changed {
+				return
+			}
+		} else if _, err := c.getAssetEntry(key); err != nil {
+			log.Println(err)
+		}
+	case filesystem.Deleted, filesystem.Renamed:
+		if !ok {
+			return
+		}
+		entry.update.Lock()
+		entry.mu.Lock()
+		entry.status = NotLoaded
+		entry.mu.Unlock()
+		entry.update.Unlock()
+		c.invalidateRender(key)
+	}
+
+	c.notifyWatchers(key)
+}
+
 func (c *FileStore) getPath(key AssetKey) string {
 	return filepath.Join(c.path, assetPath[key.AssetType], key.Name)
 }
 
-// Watch an Asset in the store, subscribing to changes
-func (c *FileStore) Watch(key AssetKey, done <-chan bool) <-chan AssetEvent {
-	ch := make(chan AssetEvent)
-
+// Watch an Asset in the store, subscribing to changes. The channel is closed
+// once done, or early if the subscriber falls behind under the Disconnect
+// overflow policy
+func (c *FileStore) Watch(key AssetKey, done <-chan bool) (<-chan AssetEvent, error) {
 	_, err := c.Get(key)
 	if err != nil {
-		log.Fatalf("Unable to watch %q, %v", key.Name, err)
+		return nil, err
 	}
 
-	// Subscribe to change events for asset
 	c.mu.RLock()
-	assetEntry := c.entries[key]
+	size, policy := c.queueSize, c.overflow
 	c.mu.RUnlock()
-	assetEntry.mu.Lock()
 
-	assetEntry.watchers[ch] = struct{}{}
+	// Subscribe to change events for asset, reloading it if evicted since
+	var assetEntry *assetEntry
+	for {
+		assetEntry, err = c.getAssetEntry(key)
+		if err != nil {
+			return nil, err
+		}
+		assetEntry.mu.Lock()
+		if !assetEntry.evicted {
+			break
+		}
+		assetEntry.mu.Unlock()
+	}
+	watcher := newAssetWatcher(size, policy, c)
+	assetEntry.watchers[watcher] = struct{}{}
 	assetEntry.mu.Unlock()
 
+	// Unsubscribe when done, the store is closed or the subscriber is
+	// disconnected for falling behind
 	go func() {
-		<-done
-		// Clear channel before closing
-		go func() {
-			for range ch {
-			}
-		}()
+		select {
+		case <-done:
+		case <-c.done:
+		case <-watcher.cancel:
+		}
+		watcher.stop()
 		assetEntry.mu.Lock()
-		delete(assetEntry.watchers, ch)
+		delete(assetEntry.watchers, watcher)
 		assetEntry.mu.Unlock()
-		close(ch)
 	}()
 
-	return ch
+	return watcher.events, nil
 }
 
 // Set creates or updates an Asset in the store with the given content
 func (c *FileStore) Set(key AssetKey, content string) error {
-	path := c.getPath(key)
+	return c.SetAs(key, content, "")
+}
 
-	file, err := c.fs.Create(path)
-	if err != nil {
-		log.Printf("%+v", errors.New("Asset not found"))
+// SetAs creates or updates an Asset, recording the author in its history
+func (c *FileStore) SetAs(key AssetKey, content string, author string) error {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	return c.commit(key, content, author)
+}
+
+// SetIfVersion updates an Asset only if its current version matches, returning
+// a ConflictError otherwise. An empty version matches only missing assets
+func (c *FileStore) SetIfVersion(key AssetKey, content string, version string) error {
+	return c.SetIfVersionAs(key, content, version, "")
+}
+
+// SetIfVersionAs updates an Asset only if its current version matches,
+// recording the author in its history
+func (c *FileStore) SetIfVersionAs(key AssetKey, content string, version string, author string) error {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	// Compare against the file system, entries are updated asynchronously
+	current := ""
+	source, err := c.fetchSource(key)
+	if err == nil {
+		current = ContentVersion(source)
+	} else if _, ok := err.(*AssetNotFound); !ok {
 		return err
 	}
 
+	if current != version {
+		return &ConflictError{
+			Key:     key,
+			Version: current,
+			Content: source,
+		}
+	}
+
+	return c.commit(key, content, author)
+}
+
+// write saves Asset content to the file system, returning any write error
+func (c *FileStore) write(key AssetKey, content string) error {
+	path := c.getPath(key)
+	previous := c.entryVersion(key)
+
+	// Replace the file atomically so watchers never read partial content
 	fmt.Printf("Setting %q with lenth %d\n", key, len(content))
-	w := bufio.NewWriter(file)
-	w.WriteString(content)
-	w.Flush()
-	file.Close()
+	if err := filesystem.WriteFile(c.fs, path, []byte(content)); err != nil {
+		log.Printf("Writing %q: %v", key, err)
+		return err
+	}
+
+	// Update the entry now rather than when the file system reports the
+	// change, so the new content is returned by Get straight away. The
+	// change is then reported here, the file system event being suppressed
+	// as unchanged
+	if _, err := c.updateAssetEntry(key); err != nil {
+		log.Println(err)
+	}
 
 	ll, err := c.getAssetEntry(key)
+	if err != nil {
+		return err
+	}
+	ll.mu.RLock()
+	changed := ll.version != previous
+	asset := ll.asset
+	ll.mu.RUnlock()
+	if changed {
+		c.notifyWatchers(key)
+	}
 
-	switch v := ll.asset.(type) {
+	switch v := asset.(type) {
 	case Component:
 		fmt.Printf("Get lenth %d\n", len(v.Source))
 	case Style:
 		fmt.Printf("Get lenth %d\n", len(v.Source))
 	}
 
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
 // Get returns and Asset from the store
 func (c *FileStore) Get(key AssetKey) (Asset, error) {
-	// Load asset from file system if not found in cache
+	asset, _, err := c.GetVersion(key)
+	return asset, err
+}
+
+// GetVersion returns an Asset from the store along with its version, which
+// changes whenever the Asset source does
+func (c *FileStore) GetVersion(key AssetKey) (Asset, string, error) {
+	// Load asset from file system if not found in cache, making room for it
 	asset, err := c.getAssetEntry(key)
+	c.evict()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
+	// Entries remain unloaded only when the asset source doesn't exist
+	asset.mu.RLock()
+	defer asset.mu.RUnlock()
 	if asset.status != Loaded {
-		return nil, errors.New("Asset not loaded")
+		return nil, "", &AssetNotFound{key}
 	}
 
-	return asset.asset, nil
+	return asset.asset, asset.version, nil
 }
 
-// List returns the AssetKeys of all entries in the store
+// List returns the AssetKeys of all loaded entries in the store. Entries of
+// assets that are referenced but missing are left out
 func (c *FileStore) List() []AssetKey {
+	c.mu.RLock()
+	entries := make(map[AssetKey]*assetEntry, len(c.entries))
+	for k, entry := range c.entries {
+		entries[k] = entry
+	}
+	c.mu.RUnlock()
+
 	result := make([]AssetKey, 0)
-	for k := range c.entries {
-		result = append(result, k)
+	for k, entry := range entries {
+		if entry.getStatus() == Loaded {
+			result = append(result, k)
+		}
 	}
 	return result
 }
 
-// Close all channels and file system watches
+// getKey returns the AssetKey of a path in the file system, false if the path
+// isn't an asset source
+func (c *FileStore) getKey(path string) (AssetKey, bool) {
+	rel, err := filepath.Rel(c.path, path)
+	if err != nil {
+		return AssetKey{}, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	// Skip hidden files and directories, including .scritti
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return AssetKey{}, false
+		}
+	}
+
+	for assetType, dir := range assetPath {
+		if strings.HasPrefix(rel, dir+"/") {
+			return AssetKey{assetType, strings.TrimPrefix(rel, dir+"/")}, true
+		}
+	}
+	return AssetKey{ComponentType, rel}, true
+}
+
+// Scan returns the AssetKeys of every asset in the file system, loaded or not
+func (c *FileStore) Scan() ([]AssetKey, error) {
+	paths, err := c.fs.List(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []AssetKey{}
+	for _, path := range paths {
+		if key, ok := c.getKey(path); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Close all channels and file system watches. Closing again has no effect
 func (c *FileStore) Close() error {
-	close(c.done)
+	c.closed.Do(func() { close(c.done) })
 	return nil
 }
@@ -2,10 +2,16 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"scritti/filesystem"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestFileStoreGet(t *testing.T) {
@@ -73,6 +79,24 @@ func TestFileStoreSet(t *testing.T) {
 			t.Errorf("Got %q, want %q", component.Source, "abcd")
 		}
 	})
+
+	t.Run("Test write error", func(t *testing.T) {
+		fsys := fstest.MapFS{"main": {Data: []byte("root")}}
+		store := NewFileStore(filesystem.NewFSFileSystem(fsys, 0), "")
+
+		err := store.Set(AssetKey{ComponentType, "main"}, "root\n\tchild")
+		if !errors.Is(err, filesystem.ErrReadOnly) {
+			t.Errorf("Got %v, want %v", err, filesystem.ErrReadOnly)
+		}
+
+		asset, err := store.Get(AssetKey{ComponentType, "main"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source := asset.(Component).Source; source != "root" {
+			t.Errorf("Got %q, want %q", source, "root")
+		}
+	})
 }
 
 func fsWrite(fs filesystem.FileSystem, name string, content string) {
@@ -96,30 +120,70 @@ func TestFileStoreWatch(t *testing.T) {
 	t.Run("Test basic watch", func(t *testing.T) {
 		store := NewFileStore(fs, "")
 		done := make(chan bool)
-		watch := store.Watch(AssetKey{ComponentType, "main"}, done)
-
-		// Watch for 2 changes
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func() {
-			<-watch
-			<-watch
-			wg.Done()
-		}()
+		watch, err := store.Watch(AssetKey{ComponentType, "main"}, done)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-		// Make 2 changes
+		// Make 2 changes, each reported once read
 		fsWrite(fs, "main", "root\n\tnode1\n\tnode2\n\tnode3")
+		<-watch
 		fsWrite(fs, "main", "root\n\tnode1\n\tnode2\n\tnode4")
+		<-watch
 
-		wg.Wait()
 		close(done)
 	})
 
+	t.Run("Test unchanged content", func(t *testing.T) {
+		source := "root\n\tnode1\n\tnode2"
+		fsWrite(fs, "main", source)
+		store := NewFileStore(fs, "")
+		defer store.Close()
+		done := make(chan bool)
+		defer close(done)
+		key := AssetKey{ComponentType, "main"}
+		_, before, err := store.GetVersion(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		watch, err := store.Watch(key, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Saving identical content is not reported
+		fsWrite(fs, "main", source)
+		select {
+		case <-watch:
+			t.Error("Unexpected event for unchanged content")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if err := store.Set(key, source); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-watch:
+			t.Error("Unexpected event for unchanged content")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		_, after, err := store.GetVersion(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after != before {
+			t.Errorf("Got version %q, want %q", after, before)
+		}
+	})
+
 	t.Run("Test watch with dependencies", func(t *testing.T) {
 		store := NewFileStore(fs, "")
 		defer store.Close()
 		done := make(chan bool)
-		watch := store.Watch(AssetKey{ComponentType, "main"}, done)
+		watch, err := store.Watch(AssetKey{ComponentType, "main"}, done)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		// Watch for 2 changes
 		var wg sync.WaitGroup
@@ -136,6 +200,18 @@ func TestFileStoreWatch(t *testing.T) {
 		close(done)
 	})
 
+	t.Run("Test watch missing asset", func(t *testing.T) {
+		store := NewFileStore(fs, "")
+		defer store.Close()
+		done := make(chan bool)
+		defer close(done)
+
+		_, err := store.Watch(AssetKey{ComponentType, "missing"}, done)
+		if err == nil {
+			t.Error("Expected error")
+		}
+	})
+
 }
 
 func TestFileStoreList(t *testing.T) {
@@ -183,3 +259,276 @@ func (a ByAssetKey) Less(i, j int) bool {
 	return a[i].Name < a[j].Name
 }
 func (a ByAssetKey) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+func TestFileStoreSetIfVersion(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "style/root", "class1")
+	store := NewFileStore(fs, "")
+	defer store.Close()
+	key := AssetKey{StyleType, "root"}
+
+	_, version, err := store.GetVersion(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Test set matching version", func(t *testing.T) {
+		if err := store.SetIfVersion(key, "class2", version); err != nil {
+			t.Fatal(err)
+		}
+		_, newVersion, err := store.GetVersion(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newVersion == version {
+			t.Error("Expected version to change")
+		}
+	})
+
+	t.Run("Test set stale version", func(t *testing.T) {
+		err := store.SetIfVersion(key, "class3", version)
+		conflict, ok := err.(*ConflictError)
+		if !ok {
+			t.Fatalf("Got %v, want ConflictError", err)
+		}
+		if conflict.Content != "class2" {
+			t.Errorf("Got content %q, want %q", conflict.Content, "class2")
+		}
+	})
+
+	t.Run("Test create with empty version", func(t *testing.T) {
+		newKey := AssetKey{StyleType, "new"}
+		if err := store.SetIfVersion(newKey, "class1", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.SetIfVersion(newKey, "class2", "").(*ConflictError); !ok {
+			t.Error("Expected ConflictError for existing asset")
+		}
+	})
+}
+
+func TestFileStoreSharedKit(t *testing.T) {
+	project := filesystem.NewMemoryFileSystem()
+	kit := filesystem.NewMemoryFileSystem()
+	fsWrite(project, "main", "root\n\tbutton")
+	fsWrite(project, "style/root", "class1")
+	fsWrite(kit, "style/button", "class2")
+
+	store := NewFileStore(filesystem.NewOverlayFileSystem(project, kit), "")
+	defer store.Close()
+
+	render := func() string {
+		asset, err := store.Get(AssetKey{ComponentType, "main"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer := new(bytes.Buffer)
+		if err := RenderComponent(buffer, asset.(Component), store.Get); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.String()
+	}
+
+	if got := render(); !strings.Contains(got, `class="class2"`) {
+		t.Errorf("Got %q, want button style from the kit", got)
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	events, err := store.Watch(AssetKey{ComponentType, "main"}, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overriding the kit style writes to the project and notifies dependants
+	if err := store.Set(AssetKey{StyleType, "button"}, "class3"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("Expected change event")
+	}
+
+	if got := render(); !strings.Contains(got, `class="class3"`) {
+		t.Errorf("Got %q, want overridden button style", got)
+	}
+	if _, err := project.Open("style/button"); err != nil {
+		t.Errorf("Expected override in the project: %v", err)
+	}
+}
+
+func TestFileStoreWatchTree(t *testing.T) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "project/main", "root\n\tbutton")
+	fsWrite(fs, "project/style/root", "class1")
+	store := NewFileStore(fs, "project")
+	defer store.Close()
+
+	done := make(chan bool)
+	defer close(done)
+	events, err := store.Watch(AssetKey{ComponentType, "main"}, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating a file is reported along with its first write, wait for both
+	expectEvent := func() {
+		t.Helper()
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("Expected change event")
+		}
+		for {
+			select {
+			case <-events:
+			case <-time.After(50 * time.Millisecond):
+				return
+			}
+		}
+	}
+
+	t.Run("Test new asset", func(t *testing.T) {
+		key := AssetKey{StyleType, "button"}
+		fsWrite(fs, "project/style/button", "class2")
+
+		// Dependants of a previously missing asset are notified
+		expectEvent()
+		found := false
+		for _, k := range store.List() {
+			found = found || k == key
+		}
+		if !found {
+			t.Errorf("Got %v, want %v listed", store.List(), key)
+		}
+		if _, err := store.Get(key); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Test deleted asset", func(t *testing.T) {
+		if err := fs.Remove("project/style/button"); err != nil {
+			t.Fatal(err)
+		}
+		expectEvent()
+
+		if _, err := store.Get(AssetKey{StyleType, "button"}); err == nil {
+			t.Error("Expected error")
+		}
+	})
+
+	t.Run("Test unrelated files", func(t *testing.T) {
+		fsWrite(fs, "project/.scritti/history/main.json", "{}")
+		select {
+		case <-events:
+			t.Error("Unexpected change event")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestFileStoreConcurrency(t *testing.T) {
+	stores := []struct {
+		name string
+		fs   func() filesystem.FileSystem
+	}{
+		{"tree watch", func() filesystem.FileSystem {
+			return filesystem.NewMemoryFileSystem()
+		}},
+		{"file watches", func() filesystem.FileSystem {
+			return fileWatchFS{filesystem.NewMemoryFileSystem(), &sync.Mutex{}, map[string]int{}}
+		}},
+	}
+
+	for _, tt := range stores {
+		t.Run("Test concurrent use with "+tt.name, func(t *testing.T) {
+			fs := tt.fs()
+			keys := []AssetKey{}
+			for i := 0; i < 4; i++ {
+				name := fmt.Sprintf("component%d", i)
+				fsWrite(fs, name, fmt.Sprintf("root\n\tstyle%d\n\tsvg.icon", i))
+				keys = append(keys, AssetKey{ComponentType, name})
+			}
+			for i := 0; i < 4; i++ {
+				name := fmt.Sprintf("style%d", i)
+				fsWrite(fs, "style/"+name, "class1")
+				keys = append(keys, AssetKey{StyleType, name})
+			}
+			fsWrite(fs, "style/root", "class1")
+			fsWrite(fs, "style/icon", "class1")
+			fsWrite(fs, "svg/icon", "<svg></svg>")
+			store := NewFileStore(fs, "")
+
+			var wg sync.WaitGroup
+			run := func(n int, fn func(i int, key AssetKey)) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < n; i++ {
+						fn(i, keys[i%len(keys)])
+					}
+				}()
+			}
+
+			for w := 0; w < 4; w++ {
+				w := w
+				run(50, func(i int, key AssetKey) {
+					content := fmt.Sprintf("class%d", i)
+					if key.AssetType == ComponentType {
+						content = fmt.Sprintf("root\n\tstyle%d", (i+w)%4)
+					}
+					store.Set(key, content)
+				})
+				run(200, func(i int, key AssetKey) {
+					store.Get(key)
+					store.GetVersion(key)
+				})
+				run(100, func(i int, key AssetKey) {
+					store.Render(key)
+					store.List()
+					store.Metrics()
+				})
+				run(50, func(i int, key AssetKey) {
+					done := make(chan bool)
+					events, err := store.Watch(key, done)
+					if err != nil {
+						return
+					}
+					go func() {
+						for range events {
+						}
+					}()
+					if i%2 == 0 {
+						close(done)
+					} else {
+						defer close(done)
+					}
+				})
+				run(20, func(i int, key AssetKey) {
+					fsWrite(fs, store.getPath(key), fmt.Sprintf("class%d", i))
+				})
+			}
+			run(1, func(i int, key AssetKey) {
+				store.Preload(4, nil)
+				store.SetCapacity(6)
+			})
+			run(1, func(i int, key AssetKey) {
+				time.Sleep(10 * time.Millisecond)
+				store.Close()
+				store.Close()
+			})
+
+			finished := make(chan bool)
+			go func() {
+				wg.Wait()
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(20 * time.Second):
+				t.Fatal("Concurrent store use deadlocked")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is how many events are queued for a subscriber before its
+// overflow policy applies
+const DefaultQueueSize = 16
+
+// OverflowPolicy chooses what happens to events for a subscriber whose queue
+// is full
+type OverflowPolicy int
+
+// OverflowPolicy enum
+const (
+	// DropOldest discards the oldest queued event to make room
+	DropOldest OverflowPolicy = iota
+	// Coalesce merges the queued events into one, every event of a
+	// subscription being a change to the same asset
+	Coalesce
+	// Disconnect ends the subscription, closing its channel
+	Disconnect
+)
+
+// ParseOverflowPolicy returns the OverflowPolicy named "drop-oldest",
+// "coalesce" or "disconnect"
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for _, policy := range []OverflowPolicy{DropOldest, Coalesce, Disconnect} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return Coalesce, fmt.Errorf("Unknown overflow policy %q, want drop-oldest, coalesce or disconnect", name)
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case Disconnect:
+		return "disconnect"
+	}
+	return "coalesce"
+}
+
+// SetOverflow sets the size of the event queue of new subscriptions, and what
+// happens to events once it is full
+func (c *FileStore) SetOverflow(size int, policy OverflowPolicy) {
+	if size < 1 {
+		size = 1
+	}
+	c.mu.Lock()
+	c.queueSize, c.overflow = size, policy
+	c.mu.Unlock()
+}
+
+// assetWatcher is a subscription to the changes of an asset. Events are
+// queued by send and delivered to the subscriber by a goroutine of its own
+type assetWatcher struct {
+	mu     sync.Mutex
+	queue  []AssetEvent
+	size   int
+	policy OverflowPolicy
+	store  *FileStore
+
+	events chan AssetEvent
+	signal chan bool
+	cancel chan bool
+	once   sync.Once
+}
+
+// newAssetWatcher returns a subscription queueing up to size events
+func newAssetWatcher(size int, policy OverflowPolicy, store *FileStore) *assetWatcher {
+	w := &assetWatcher{
+		size:   size,
+		policy: policy,
+		store:  store,
+		events: make(chan AssetEvent),
+		signal: make(chan bool, 1),
+		cancel: make(chan bool),
+	}
+	go w.deliver()
+	return w
+}
+
+// send queues an event without blocking, applying the overflow policy when
+// the queue is full
+func (w *assetWatcher) send(event AssetEvent) {
+	w.mu.Lock()
+	if len(w.queue) >= w.size {
+		switch w.policy {
+		case DropOldest:
+			w.queue = w.queue[1:]
+			atomic.AddUint64(&w.store.dropped, 1)
+		case Coalesce:
+			for _, queued := range w.queue {
+				event.direct = event.direct || queued.direct
+			}
+			atomic.AddUint64(&w.store.dropped, uint64(len(w.queue)))
+			w.queue = w.queue[:0]
+		case Disconnect:
+			atomic.AddUint64(&w.store.dropped, uint64(len(w.queue)+1))
+			atomic.AddUint64(&w.store.disconnects, 1)
+			w.queue = nil
+			w.mu.Unlock()
+			w.stop()
+			return
+		}
+	}
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+
+	select {
+	case w.signal <- true:
+	default:
+	}
+}
+
+// stop ends the subscription, discarding queued events
+func (w *assetWatcher) stop() {
+	w.once.Do(func() { close(w.cancel) })
+}
+
+// deliver sends queued events to the subscriber until stopped, then closes
+// the subscriber's channel
+func (w *assetWatcher) deliver() {
+	defer close(w.events)
+	for {
+		select {
+		case <-w.signal:
+		case <-w.cancel:
+			return
+		}
+
+		for {
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.mu.Unlock()
+				break
+			}
+			event := w.queue[0]
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+
+			select {
+			case w.events <- event:
+			case <-w.cancel:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"fmt"
+	"scritti/filesystem"
+	"testing"
+	"time"
+)
+
+func TestFileStoreOverflow(t *testing.T) {
+	key := AssetKey{ComponentType, "main"}
+	newStore := func(size int, policy OverflowPolicy) *FileStore {
+		fs := filesystem.NewMemoryFileSystem()
+		fsWrite(fs, "main", "root")
+		fsWrite(fs, "style/root", "class1")
+		store := NewFileStore(fs, "")
+		store.SetOverflow(size, policy)
+		return store
+	}
+
+	// set makes n changes, failing if any is held up by a subscriber
+	changes := 0
+	set := func(t *testing.T, store *FileStore, n int) {
+		finished := make(chan bool)
+		go func() {
+			for i := 0; i < n; i++ {
+				changes++
+				if err := store.Set(key, fmt.Sprintf("root\n\tchild%d", changes)); err != nil {
+					t.Error(err)
+				}
+			}
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Set blocked by a stalled subscriber")
+		}
+	}
+
+	// drain counts the events received until none arrive for a while
+	drain := func(watch <-chan AssetEvent) (int, bool) {
+		n := 0
+		for {
+			select {
+			case _, ok := <-watch:
+				if !ok {
+					return n, false
+				}
+				n++
+			case <-time.After(100 * time.Millisecond):
+				return n, true
+			}
+		}
+	}
+
+	t.Run("Test stalled subscriber", func(t *testing.T) {
+		store := newStore(2, DropOldest)
+		defer store.Close()
+		done := make(chan bool)
+		defer close(done)
+		stalled, err := store.Watch(key, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+		live, err := store.Watch(key, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The live subscriber sees every change while the other reads nothing
+		for i := 0; i < 10; i++ {
+			set(t, store, 1)
+			select {
+			case <-live:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Change %d not delivered", i)
+			}
+		}
+
+		if m := store.Metrics(); m.Dropped == 0 {
+			t.Errorf("Got %d dropped events, want some", m.Dropped)
+		}
+
+		// At most the queue and the event being delivered remain
+		if n, open := drain(stalled); !open || n == 0 || n > 3 {
+			t.Errorf("Got %d events, open %v, want 1 to 3 and open", n, open)
+		}
+	})
+
+	t.Run("Test coalesce", func(t *testing.T) {
+		store := newStore(1, Coalesce)
+		defer store.Close()
+		done := make(chan bool)
+		defer close(done)
+		watch, err := store.Watch(key, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		set(t, store, 10)
+		if n, open := drain(watch); !open || n == 0 || n > 2 {
+			t.Errorf("Got %d events, open %v, want 1 or 2 and open", n, open)
+		}
+		if m := store.Metrics(); m.Dropped == 0 || m.Disconnects != 0 {
+			t.Errorf("Got %d dropped and %d disconnects, want some and 0", m.Dropped, m.Disconnects)
+		}
+
+		// Still subscribed after coalescing
+		set(t, store, 1)
+		select {
+		case <-watch:
+		case <-time.After(5 * time.Second):
+			t.Error("Change not delivered after coalescing")
+		}
+	})
+
+	t.Run("Test disconnect", func(t *testing.T) {
+		store := newStore(1, Disconnect)
+		defer store.Close()
+		done := make(chan bool)
+		defer close(done)
+		watch, err := store.Watch(key, done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		set(t, store, 10)
+		if _, open := drain(watch); open {
+			t.Error("Expected the subscription to be closed")
+		}
+		if m := store.Metrics(); m.Disconnects != 1 || m.Dropped == 0 {
+			t.Errorf("Got %d disconnects and %d dropped, want 1 and some", m.Disconnects, m.Dropped)
+		}
+
+		// The subscription is removed from its entry
+		store.mu.RLock()
+		entry := store.entries[key]
+		store.mu.RUnlock()
+		for i := 0; ; i++ {
+			entry.mu.RLock()
+			n := len(entry.watchers)
+			entry.mu.RUnlock()
+			if n == 0 {
+				break
+			}
+			if i == 100 {
+				t.Fatalf("Got %d watchers, want 0", n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Test parse overflow policy", func(t *testing.T) {
+		for _, policy := range []OverflowPolicy{DropOldest, Coalesce, Disconnect} {
+			parsed, err := ParseOverflowPolicy(policy.String())
+			if err != nil || parsed != policy {
+				t.Errorf("Got %v, %v, want %v", parsed, err, policy)
+			}
+		}
+		if _, err := ParseOverflowPolicy("block"); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
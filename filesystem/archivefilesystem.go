@@ -0,0 +1,159 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveFileSystem is a project loaded from a .zip, .tar.gz or .tgz archive.
+// Files are copied into memory, changes are kept there and never written back
+// to the archive
+type ArchiveFileSystem struct {
+	*MemoryFileSystem
+}
+
+// IsArchive reports whether a file name has a supported archive extension
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".zip") ||
+		strings.HasSuffix(name, ".tar.gz") ||
+		strings.HasSuffix(name, ".tgz")
+}
+
+// NewArchiveFileSystem reads every file of an archive into memory. When all
+// files are beneath a single top level directory it is stripped, so archives
+// of a project directory open the same as archives of its contents
+func NewArchiveFileSystem(name string) (*ArchiveFileSystem, error) {
+	files := make(map[string][]byte)
+	add := func(name string, r io.Reader) error {
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+		return nil
+	}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		err = readZip(name, add)
+	} else if IsArchive(name) {
+		err = readTarGz(name, add)
+	} else {
+		err = fmt.Errorf("Unsupported archive %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := commonDir(files)
+	fs := &ArchiveFileSystem{NewMemoryFileSystem()}
+	for name, data := range files {
+		file, err := fs.Create(strings.TrimPrefix(name, prefix))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+		file.Close()
+	}
+	return fs, nil
+}
+
+// assetDirs are the project directories of styles and SVGs. They are never
+// stripped as a wrapper, so kits holding only styles or SVGs keep them
+var assetDirs = map[string]bool{
+	"style/": true,
+	"svg/":   true,
+}
+
+// commonDir returns the top level directory shared by every file, with a
+// trailing slash, or an empty string if there is none or it is an asset
+// directory
+func commonDir(files map[string][]byte) string {
+	prefix := ""
+	for name := range files {
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return ""
+		}
+		if len(prefix) == 0 {
+			prefix = name[:i+1]
+		} else if !strings.HasPrefix(name, prefix) {
+			return ""
+		}
+	}
+	if assetDirs[prefix] {
+		return ""
+	}
+	return prefix
+}
+
+// readZip calls add with the content of each regular file in a zip archive
+func readZip(name string, add func(string, io.Reader) error) error {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = add(f.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTarGz calls add with the content of each regular file in a gzipped tar archive
+func readTarGz(name string, add func(string, io.Reader) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := add(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var archiveFiles = map[string]string{
+	"kit/main":       "root",
+	"kit/style/root": "class1",
+}
+
+func writeZip(t *testing.T, name string) {
+	writeZipFiles(t, name, archiveFiles)
+}
+
+func writeZipFiles(t *testing.T, name string, files map[string]string) {
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, name string) {
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	w := tar.NewWriter(gz)
+	w.WriteHeader(&tar.Header{Name: "kit/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range archiveFiles {
+		w.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		w.Write([]byte(content))
+	}
+	w.Close()
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name  string
+		write func(*testing.T, string)
+	}{
+		{"design.zip", writeZip},
+		{"design.tar.gz", writeTarGz},
+	} {
+		t.Run("Test Archive File System - "+tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name)
+			tt.write(t, name)
+
+			if !IsArchive(name) {
+				t.Errorf("Expected %q to be an archive", name)
+			}
+			fs, err := NewArchiveFileSystem(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := fs.Open("style/root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(file)
+			if got := string(data); got != "class1" {
+				t.Errorf("Got %q, want %q", got, "class1")
+			}
+
+			// Writes are kept in memory
+			fsWrite(fs, "main", "root\n\tchild")
+			file, _ = fs.Open("main")
+			data, _ = ioutil.ReadAll(file)
+			if got := string(data); got != "root\n\tchild" {
+				t.Errorf("Got %q, want %q", got, "root\n\tchild")
+			}
+
+			names, _ := fs.List(".")
+			if len(names) != 2 {
+				t.Errorf("Got %q, want 2 files", names)
+			}
+		})
+	}
+
+	t.Run("Test Archive File System - Style kit", func(t *testing.T) {
+		name := filepath.Join(dir, "kit.zip")
+		writeZipFiles(t, name, map[string]string{
+			"style/button": "class1",
+			"style/card":   "class2",
+		})
+		fs, err := NewArchiveFileSystem(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The style directory is not mistaken for a wrapper
+		if _, err := fs.Open("style/button"); err != nil {
+			t.Error(err)
+		}
+		if _, err := fs.Open("button"); err == nil {
+			t.Error("Expected style to stay beneath style/")
+		}
+	})
+
+	t.Run("Test Archive File System - Unsupported", func(t *testing.T) {
+		if _, err := NewArchiveFileSystem(filepath.Join(dir, "design.rar")); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// tempCount distinguishes the temporary files of concurrent writes
+var tempCount uint64
+
+// syncer is implemented by files that can be flushed to storage, such as *os.File
+type syncer interface {
+	Sync() error
+}
+
+// tempName returns a hidden name beside a file for writing its replacement
+func tempName(name string) string {
+	n := atomic.AddUint64(&tempCount, 1)
+	dir, base := filepath.Split(name)
+	return filepath.Join(dir, fmt.Sprintf(".%s.%d-%d.tmp", base, os.Getpid(), n))
+}
+
+// WriteFile atomically replaces the content of a file. The content is written
+// to a temporary file beside it, synced to storage, then renamed over the
+// file, so readers see either the previous or the new content in full
+func WriteFile(fs FileSystem, name string, data []byte) error {
+	temp := tempName(name)
+	file, err := fs.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if s, ok := file.(syncer); ok && err == nil {
+		err = s.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(temp, name)
+	}
+	if err != nil {
+		fs.Remove(temp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package filesystem_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scritti/filesystem"
+	"scritti/filesystem/filesystemtest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// tempDir returns a temporary directory removed when the test finishes
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestOSFileSystemConformance(t *testing.T) {
+	filesystemtest.Run(t, func(t *testing.T) filesystem.FileSystem {
+		return filesystem.NewSubFileSystem(filesystem.NewOSFileSystem(), tempDir(t))
+	})
+}
+
+func TestPollingFileSystemConformance(t *testing.T) {
+	filesystemtest.Run(t, func(t *testing.T) filesystem.FileSystem {
+		return filesystem.NewSubFileSystem(filesystem.NewPollingFileSystem(10*time.Millisecond), tempDir(t))
+	})
+}
+
+func TestMemoryFileSystemConformance(t *testing.T) {
+	filesystemtest.Run(t, func(t *testing.T) filesystem.FileSystem {
+		return filesystem.NewMemoryFileSystem()
+	})
+}
+
+func TestOverlayFileSystemConformance(t *testing.T) {
+	filesystemtest.Run(t, func(t *testing.T) filesystem.FileSystem {
+		return filesystem.NewOverlayFileSystem(
+			filesystem.NewMemoryFileSystem(),
+			filesystem.NewSubFileSystem(filesystem.NewOSFileSystem(), tempDir(t)),
+		)
+	})
+}
+
+func TestArchiveFileSystemConformance(t *testing.T) {
+	filesystemtest.RunReadOnly(t, func(t *testing.T, files map[string]string) filesystem.FileSystem {
+		name := filepath.Join(tempDir(t), "project.zip")
+		file, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := zip.NewWriter(file)
+		for path, content := range files {
+			f, err := w.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]byte(content))
+		}
+		w.Close()
+		file.Close()
+
+		fs, err := filesystem.NewArchiveFileSystem(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	})
+}
+
+func TestFSFileSystemConformance(t *testing.T) {
+	filesystemtest.RunReadOnly(t, func(t *testing.T, files map[string]string) filesystem.FileSystem {
+		fsys := fstest.MapFS{}
+		for name, content := range files {
+			fsys[name] = &fstest.MapFile{Data: []byte(content), ModTime: time.Now()}
+		}
+		return filesystem.NewFSFileSystem(fsys, 0)
+	})
+}
@@ -29,5 +29,9 @@ type FileSystem interface {
 	Create(name string) (File, error)
 	Open(name string) (File, error)
 	Stat(name string) (os.FileInfo, error)
+	Rename(oldname string, newname string) error
+	Remove(name string) error
 	Watch(name string, done <-chan bool) (<-chan bool, error)
+	WatchTree(root string, done <-chan bool) (<-chan Event, error)
+	List(root string) ([]string, error)
 }
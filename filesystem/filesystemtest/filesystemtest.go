@@ -0,0 +1,666 @@
+// Package filesystemtest provides a conformance suite that every
+// filesystem.FileSystem implementation must pass
+package filesystemtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scritti/filesystem"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// eventTimeout is how long to wait for a change event
+const eventTimeout = 2 * time.Second
+
+// quietPeriod is how long without events before a watch is considered settled
+const quietPeriod = 50 * time.Millisecond
+
+// Factory returns an empty, writable FileSystem. Names used by the suite are
+// relative, so implementations backed by the OS should be rooted in a
+// temporary directory
+type Factory func(t *testing.T) filesystem.FileSystem
+
+// ReadOnlyFactory returns a FileSystem holding the given files, for
+// implementations whose content is fixed when they are created. Names are
+// slash separated
+type ReadOnlyFactory func(t *testing.T, files map[string]string) filesystem.FileSystem
+
+// files are the contents of every FileSystem the read tests run against
+var files = map[string]string{
+	"main":        "0123456789",
+	"style/root":  "class1",
+	"style/child": "class2",
+}
+
+// test is a named conformance test
+type test struct {
+	name string
+	fn   func(*testing.T, filesystem.FileSystem)
+}
+
+// readTests only read the files FileSystems are created with
+var readTests = []test{
+	{"Open", testOpen},
+	{"Missing files", testMissing},
+	{"Seek and ReadAt", testSeek},
+	{"Stat", testStat},
+	{"List", testList},
+	{"io/fs", testIOFS},
+}
+
+// Run runs the conformance suite against FileSystems returned by factory
+func Run(t *testing.T, factory Factory) {
+	RunReadOnly(t, func(t *testing.T, files map[string]string) filesystem.FileSystem {
+		fs := factory(t)
+		for name, content := range files {
+			write(t, fs, filepath.FromSlash(name), content)
+		}
+		return fs
+	})
+
+	tests := []test{
+		{"Create", testCreate},
+		{"Missing file writes", testMissingWrites},
+		{"Sequential writes", testSequentialWrites},
+		{"Closed files", testClosed},
+		{"Watch", testWatch},
+		{"Watch cancellation", testWatchCancellation},
+		{"Watch after rename", testWatchRename},
+		{"Watch after remove", testWatchRemove},
+		{"Watch tree", testWatchTree},
+		{"Watch tree cancellation", testWatchTreeCancellation},
+		{"Concurrent writers", testConcurrentWriters},
+		{"Atomic writes", testAtomicWrites},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Test "+tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+// RunReadOnly runs the tests of the conformance suite that only read files
+// against FileSystems returned by factory
+func RunReadOnly(t *testing.T, factory ReadOnlyFactory) {
+	for _, tt := range readTests {
+		tt := tt
+		t.Run("Test "+tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t, files))
+		})
+	}
+}
+
+// writeFile replaces the content of a file
+func writeFile(fs filesystem.FileSystem, name string, content string) error {
+	file, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// write replaces the content of a file, failing the test on error
+func write(t *testing.T, fs filesystem.FileSystem, name string, content string) {
+	t.Helper()
+	if err := writeFile(fs, name, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the content of a file
+func read(t *testing.T, fs filesystem.FileSystem, name string) string {
+	t.Helper()
+	file, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// waitEvent waits for a change event, then for the watch to settle as some
+// backends report a single change as several events
+func waitEvent(events <-chan bool) error {
+	select {
+	case _, ok := <-events:
+		if !ok {
+			return errors.New("Channel is closed")
+		}
+	case <-time.After(eventTimeout):
+		return errors.New("Expected change event")
+	}
+	settle(events)
+	return nil
+}
+
+// expectEvent waits for a change event, failing the test if none arrives
+func expectEvent(t *testing.T, events <-chan bool) {
+	t.Helper()
+	if err := waitEvent(events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// settle discards events until none arrive for the quiet period
+func settle(events <-chan bool) {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-time.After(quietPeriod):
+			return
+		}
+	}
+}
+
+// expectClosed waits for a watch channel to close
+func expectClosed(t *testing.T, events <-chan bool) {
+	t.Helper()
+	timeout := time.After(eventTimeout)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Channel is not closed")
+		}
+	}
+}
+
+func testCreate(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "Long initial content")
+	write(t, fs, "main", "Short")
+	if got := read(t, fs, "main"); got != "Short" {
+		t.Errorf("Got %q, want %q, Create must truncate", got, "Short")
+	}
+
+	write(t, fs, filepath.Join("style", "icons", "root"), "class1")
+	if got := read(t, fs, filepath.Join("style", "icons", "root")); got != "class1" {
+		t.Errorf("Got %q, want %q, Create must make parent directories", got, "class1")
+	}
+}
+
+func testOpen(t *testing.T, fs filesystem.FileSystem) {
+	// Each open file reads from the start
+	first, _ := fs.Open("main")
+	defer first.Close()
+	second, _ := fs.Open("main")
+	defer second.Close()
+	p := make([]byte, 4)
+	first.Read(p)
+	data, _ := ioutil.ReadAll(second)
+	if string(data) != "0123456789" {
+		t.Errorf("Got %q, want %q", data, "0123456789")
+	}
+}
+
+func testMissing(t *testing.T, fs filesystem.FileSystem) {
+	if _, err := fs.Open("missing"); err == nil {
+		t.Error("Expected error opening missing file")
+	} else if _, ok := err.(*filesystem.FileNotFound); !ok {
+		t.Errorf("Got %T, want *FileNotFound", err)
+	}
+
+	if _, err := fs.Stat("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got %v, want os.ErrNotExist from Stat", err)
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	if _, err := fs.Watch("missing", done); err == nil {
+		t.Error("Expected error watching missing file")
+	} else if _, ok := err.(*filesystem.FileNotFound); !ok {
+		t.Errorf("Got %T, want *FileNotFound from Watch", err)
+	}
+}
+
+func testMissingWrites(t *testing.T, fs filesystem.FileSystem) {
+	if err := fs.Remove("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got %v, want os.ErrNotExist from Remove", err)
+	}
+	if err := fs.Rename("missing", "other"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got %v, want os.ErrNotExist from Rename", err)
+	}
+}
+
+func testSequentialWrites(t *testing.T, fs filesystem.FileSystem) {
+	file, err := fs.Create("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("root"))
+	file.Write([]byte("\n\tchild"))
+	file.Close()
+	if got := read(t, fs, "main"); got != "root\n\tchild" {
+		t.Errorf("Got %q, want %q", got, "root\n\tchild")
+	}
+
+	write(t, fs, "main", "Old content")
+	write(t, fs, "main", "New content")
+	if got := read(t, fs, "main"); got != "New content" {
+		t.Errorf("Got %q, want %q", got, "New content")
+	}
+}
+
+func testSeek(t *testing.T, fs filesystem.FileSystem) {
+	file, err := fs.Open("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	p := make([]byte, 3)
+	if n, err := file.ReadAt(p, 4); n != 3 || err != nil || string(p) != "456" {
+		t.Errorf("Got %d %v %q, want 3 <nil> %q", n, err, p, "456")
+	}
+	if n, err := file.ReadAt(p, 8); n != 2 || err != io.EOF {
+		t.Errorf("Got %d %v, want 2 EOF", n, err)
+	}
+
+	if offset, err := file.Seek(-2, io.SeekEnd); offset != 8 || err != nil {
+		t.Errorf("Got %d %v, want 8 <nil>", offset, err)
+	}
+	data, _ := ioutil.ReadAll(file)
+	if string(data) != "89" {
+		t.Errorf("Got %q, want %q", data, "89")
+	}
+	if _, err := file.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected error seeking before the start")
+	}
+}
+
+func testStat(t *testing.T, fs filesystem.FileSystem) {
+	name := filepath.Join("style", "root")
+	info, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "root" || info.Size() != 6 || info.IsDir() || info.ModTime().IsZero() {
+		t.Errorf("Got %s %d %v %v, want root 6 false and a mod time", info.Name(), info.Size(), info.IsDir(), info.ModTime())
+	}
+
+	file, _ := fs.Open(name)
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.Size() != 6 {
+		t.Errorf("Got %v, want file size 6", err)
+	}
+
+	if info, err := fs.Stat("style"); err != nil || !info.IsDir() {
+		t.Errorf("Got %v, want style to be a directory", err)
+	}
+}
+
+func testClosed(t *testing.T, fs filesystem.FileSystem) {
+	file, _ := fs.Create("main")
+	file.Close()
+	if _, err := file.Write([]byte("root")); err == nil {
+		t.Error("Expected error writing a closed file")
+	}
+	if err := file.Close(); err == nil {
+		t.Error("Expected error closing twice")
+	}
+}
+
+func testList(t *testing.T, fs filesystem.FileSystem) {
+	names, err := fs.List("style")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join("style", "child"), filepath.Join("style", "root")}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("Got %q, want %q", names, want)
+	}
+
+	if names, err := fs.List("missing"); err != nil || len(names) != 0 {
+		t.Errorf("Got %q %v, want no files", names, err)
+	}
+}
+
+func testWatch(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "Initial content")
+	done := make(chan bool)
+	defer close(done)
+
+	// Every watcher is notified of every change
+	watchers := []<-chan bool{}
+	for i := 0; i < 2; i++ {
+		events, err := fs.Watch("main", done)
+		if err != nil {
+			t.Fatal(err)
+		}
+		watchers = append(watchers, events)
+	}
+
+	for _, content := range []string{"First change", "Second change"} {
+		var wg sync.WaitGroup
+		wg.Add(len(watchers))
+		for _, events := range watchers {
+			go func(events <-chan bool) {
+				defer wg.Done()
+				if err := waitEvent(events); err != nil {
+					t.Error(err)
+				}
+			}(events)
+		}
+		write(t, fs, "main", content)
+		wg.Wait()
+
+		if got := read(t, fs, "main"); got != content {
+			t.Errorf("Got %q, want %q", got, content)
+		}
+	}
+
+	// Changes to other files are not reported
+	write(t, fs, "other", "content")
+	select {
+	case <-watchers[0]:
+		t.Error("Unexpected event for another file")
+	case <-time.After(quietPeriod):
+	}
+}
+
+func testWatchCancellation(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "Initial content")
+	done := make(chan bool)
+	events, err := fs.Watch("main", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(done)
+	expectClosed(t, events)
+
+	// Writes after cancellation must not block on the closed watch
+	finished := make(chan bool)
+	go func() {
+		if err := writeFile(fs, "main", "New content"); err != nil {
+			t.Error(err)
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(eventTimeout):
+		t.Fatal("Write blocked after watch cancellation")
+	}
+}
+
+func testWatchRename(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "Initial content")
+	done := make(chan bool)
+	defer close(done)
+	events, err := fs.Watch("main", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Editors save by renaming a temporary file over the original
+	write(t, fs, "main.tmp", "Renamed content")
+	settle(events)
+	if err := fs.Rename("main.tmp", "main"); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events)
+	if got := read(t, fs, "main"); got != "Renamed content" {
+		t.Errorf("Got %q, want %q", got, "Renamed content")
+	}
+
+	// The replacement is still watched
+	write(t, fs, "main", "New content")
+	expectEvent(t, events)
+}
+
+func testWatchRemove(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "Initial content")
+	done := make(chan bool)
+	defer close(done)
+	events, err := fs.Watch("main", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Remove("main"); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events)
+	if _, err := fs.Open("main"); err == nil {
+		t.Error("Expected removed file to be missing")
+	}
+
+	// Creating the file again is reported to the same watch
+	write(t, fs, "main", "New content")
+	expectEvent(t, events)
+	if got := read(t, fs, "main"); got != "New content" {
+		t.Errorf("Got %q, want %q", got, "New content")
+	}
+}
+
+// expectTreeEvent waits for an event for a file, skipping others as backends
+// may report a single change as several events
+func expectTreeEvent(t *testing.T, events <-chan filesystem.Event, name string, op filesystem.Op) {
+	t.Helper()
+	timeout := time.After(eventTimeout)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("Channel is closed")
+			}
+			if event.Name == name && event.Op == op {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected %s event for %q", op, name)
+		}
+	}
+}
+
+func testWatchTree(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "root")
+	done := make(chan bool)
+	defer close(done)
+	events, err := fs.WatchTree(".", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join("style", "icons", "root")
+	write(t, fs, name, "class1")
+	expectTreeEvent(t, events, name, filesystem.Created)
+
+	write(t, fs, "main", "root\n\tchild")
+	expectTreeEvent(t, events, "main", filesystem.Modified)
+
+	renamed := filepath.Join("style", "icons", "child")
+	if err := fs.Rename(name, renamed); err != nil {
+		t.Fatal(err)
+	}
+	expectTreeEvent(t, events, name, filesystem.Renamed)
+	expectTreeEvent(t, events, renamed, filesystem.Created)
+
+	if err := fs.Remove(renamed); err != nil {
+		t.Fatal(err)
+	}
+	expectTreeEvent(t, events, renamed, filesystem.Deleted)
+}
+
+func testWatchTreeCancellation(t *testing.T, fs filesystem.FileSystem) {
+	write(t, fs, "main", "root")
+	done := make(chan bool)
+	events, err := fs.WatchTree(".", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, fs, "main", "root\n\tchild")
+	close(done)
+
+	timeout := time.After(eventTimeout)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Channel is not closed")
+		}
+	}
+}
+
+func testAtomicWrites(t *testing.T, fs filesystem.FileSystem) {
+	name := filepath.Join("style", "root")
+	if err := filesystem.WriteFile(fs, name, []byte("Initial content")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, fs, name); got != "Initial content" {
+		t.Errorf("Got %q, want %q", got, "Initial content")
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	events, err := fs.Watch(name, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers only ever see complete content while it is replaced. Writes
+	// are made in order, the last differing from the initial content so
+	// polling backends always see a change
+	writes := []string{}
+	contents := map[string]bool{"Initial content": true}
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("Content %02d %s", i, strings.Repeat("x", i*100))
+		writes = append(writes, content)
+		contents[content] = true
+	}
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			file, err := fs.Open(name)
+			if err != nil {
+				t.Errorf("Open during replace: %v", err)
+				return
+			}
+			data, err := ioutil.ReadAll(file)
+			file.Close()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !contents[string(data)] {
+				t.Errorf("Read partial content %q", data)
+				return
+			}
+		}
+	}()
+	for _, content := range writes {
+		if err := filesystem.WriteFile(fs, name, []byte(content)); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	expectEvent(t, events)
+
+	// No temporary files are left behind
+	names, err := fs.List(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || filepath.Clean(names[0]) != name {
+		t.Errorf("Got %q, want [%q]", names, name)
+	}
+}
+
+func testConcurrentWriters(t *testing.T, fs filesystem.FileSystem) {
+	const writers = 8
+	write(t, fs, "shared", "Initial content")
+
+	done := make(chan bool)
+	defer close(done)
+	events, err := fs.Watch("shared", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range events {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("file%d", i)
+			for j := 0; j < 10; j++ {
+				content := fmt.Sprintf("writer %d revision %d", i, j)
+				if err := writeFile(fs, name, content); err != nil {
+					t.Error(err)
+					return
+				}
+				file, err := fs.Open(name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, _ := ioutil.ReadAll(file)
+				file.Close()
+				if string(data) != content {
+					t.Errorf("Got %q, want %q", data, content)
+				}
+
+				file, err = fs.Create("shared")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				file.Write([]byte(content))
+				file.Close()
+				fs.List(".")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := fs.Stat("shared"); err != nil {
+		t.Error(err)
+	}
+}
+
+func testIOFS(t *testing.T, fs filesystem.FileSystem) {
+	if err := fstest.TestFS(filesystem.NewIOFS(fs), "main", "style/root", "style/child"); err != nil {
+		t.Error(err)
+	}
+}
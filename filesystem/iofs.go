@@ -0,0 +1,380 @@
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned when writing to a read-only file system
+var ErrReadOnly = errors.New("Read-only file system")
+
+// errUnsupported is returned by fs.File adapters lacking an optional method
+var errUnsupported = errors.New("Operation not supported")
+
+// FSFileSystem exposes an fs.FS, such as an embed.FS or os.DirFS, as a
+// read-only FileSystem
+type FSFileSystem struct {
+	fsys     fs.FS
+	interval time.Duration
+}
+
+// NewFSFileSystem returns a read-only FileSystem reading from fsys. Watched
+// files are polled for changes every interval, or never change if it is zero
+func NewFSFileSystem(fsys fs.FS, interval time.Duration) *FSFileSystem {
+	return &FSFileSystem{fsys, interval}
+}
+
+// fsName converts a file name to the unrooted, slash separated form io/fs expects
+func fsName(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	return strings.TrimPrefix(name, "/")
+}
+
+// fsFile adapts an fs.File to File, seeking and reading at offsets when the
+// underlying file supports it
+type fsFile struct {
+	fs.File
+}
+
+func (f fsFile) Write(p []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (f fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, errUnsupported
+}
+
+func (f fsFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errUnsupported
+}
+
+// Create always fails, the file system is read-only
+func (FSFileSystem) Create(name string) (File, error) {
+	return nil, &fs.PathError{Op: "create", Path: name, Err: ErrReadOnly}
+}
+
+// Rename always fails, the file system is read-only
+func (FSFileSystem) Rename(oldname string, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+// Remove always fails, the file system is read-only
+func (FSFileSystem) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+// Open a file
+func (f FSFileSystem) Open(name string) (File, error) {
+	file, err := f.fsys.Open(fsName(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &FileNotFound{name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fsFile{file}, nil
+}
+
+// Stat a file
+func (f FSFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(f.fsys, fsName(name))
+}
+
+// Watch a file for changes by polling its content. Without a polling interval
+// the returned channel only closes when done
+func (f FSFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	content, err := fs.ReadFile(f.fsys, fsName(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &FileNotFound{name}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(chan bool)
+	go func() {
+		defer close(files)
+		if f.interval <= 0 {
+			<-done
+			return
+		}
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			latest, err := fs.ReadFile(f.fsys, fsName(name))
+			if err != nil || bytes.Equal(latest, content) {
+				continue
+			}
+			content = latest
+
+			select {
+			case files <- true:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return files, nil
+}
+
+// WatchTree reports changes to every file beneath a directory by polling
+// their content. Without a polling interval no changes are reported
+func (f FSFileSystem) WatchTree(root string, done <-chan bool) (<-chan Event, error) {
+	// snapshot returns the content of every file beneath root
+	snapshot := func() (map[string][]byte, error) {
+		names, err := f.List(root)
+		if err != nil {
+			return nil, err
+		}
+		files := make(map[string][]byte, len(names))
+		for _, name := range names {
+			if content, err := fs.ReadFile(f.fsys, fsName(name)); err == nil {
+				files[name] = content
+			}
+		}
+		return files, nil
+	}
+
+	files, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		if f.interval <= 0 {
+			<-done
+			return
+		}
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			latest, err := snapshot()
+			if err != nil {
+				continue
+			}
+			changes := []Event{}
+			for name, content := range latest {
+				previous, ok := files[name]
+				if !ok {
+					changes = append(changes, Event{name, Created})
+				} else if !bytes.Equal(previous, content) {
+					changes = append(changes, Event{name, Modified})
+				}
+			}
+			for name := range files {
+				if _, ok := latest[name]; !ok {
+					changes = append(changes, Event{name, Deleted})
+				}
+			}
+			files = latest
+
+			sort.Slice(changes, func(i, j int) bool {
+				return changes[i].Name < changes[j].Name
+			})
+			for _, change := range changes {
+				select {
+				case events <- change:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// List returns the names of all files beneath a directory
+func (f FSFileSystem) List(root string) ([]string, error) {
+	names := []string{}
+	err := fs.WalkDir(f.fsys, fsName(root), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, filepath.FromSlash(name))
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return names, nil
+	}
+	return names, err
+}
+
+// ioFS exposes a FileSystem as an fs.FS. Directories are derived from the
+// names listed by the FileSystem
+type ioFS struct {
+	fs FileSystem
+}
+
+// NewIOFS returns an fs.FS reading from a FileSystem, for use with standard
+// library tooling such as fs.WalkDir
+func NewIOFS(fs FileSystem) fs.FS {
+	return ioFS{fs}
+}
+
+// Open a file or directory
+func (f ioFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		file, err := f.fs.Open(filepath.FromSlash(name))
+		switch err.(type) {
+		case nil:
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			if !info.IsDir() {
+				return file, nil
+			}
+			file.Close()
+		case *FileNotFound:
+		default:
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	entries, err := f.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ioDir{name: name, entries: entries}, nil
+}
+
+// ReadDir returns the files and directories directly beneath a directory
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	paths, err := f.fs.List(filepath.FromSlash(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	seen := map[string]fs.DirEntry{}
+	for _, p := range paths {
+		rel := strings.TrimPrefix(filepath.ToSlash(p), prefix)
+		if rel == filepath.ToSlash(p) && len(prefix) > 0 {
+			continue
+		}
+		if i := strings.Index(rel, "/"); i >= 0 {
+			seen[rel[:i]] = ioDirEntry{name: rel[:i]}
+		} else if _, ok := seen[rel]; !ok {
+			seen[rel] = ioFileEntry{f.fs, p}
+		}
+	}
+	if len(seen) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(seen))
+	for _, entry := range seen {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ioDir is an open directory of an ioFS
+type ioDir struct {
+	name    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *ioDir) Stat() (fs.FileInfo, error) {
+	return ioDirEntry{name: path.Base(d.name)}, nil
+}
+
+func (d *ioDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *ioDir) Close() error {
+	return nil
+}
+
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// ioDirEntry describes a directory, as both a DirEntry and its FileInfo
+type ioDirEntry struct {
+	name string
+}
+
+func (e ioDirEntry) Name() string               { return e.name }
+func (e ioDirEntry) IsDir() bool                { return true }
+func (e ioDirEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e ioDirEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e ioDirEntry) Size() int64                { return 0 }
+func (e ioDirEntry) Mode() fs.FileMode          { return fs.ModeDir | 0555 }
+func (e ioDirEntry) ModTime() time.Time         { return time.Time{} }
+func (e ioDirEntry) Sys() interface{}           { return nil }
+
+// ioFileEntry describes a file, statting it only when its info is needed
+type ioFileEntry struct {
+	fs   FileSystem
+	path string
+}
+
+func (e ioFileEntry) Name() string      { return filepath.Base(e.path) }
+func (e ioFileEntry) IsDir() bool       { return false }
+func (e ioFileEntry) Type() fs.FileMode { return 0 }
+func (e ioFileEntry) Info() (fs.FileInfo, error) {
+	return e.fs.Stat(e.path)
+}
@@ -0,0 +1,112 @@
+package filesystem
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFSFileSystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main":       {Data: []byte("root")},
+		"style/root": {Data: []byte("class1")},
+	}
+
+	t.Run("Test FS File System - Open", func(t *testing.T) {
+		fs := NewFSFileSystem(fsys, 0)
+		if got := readAll(t, fs, "style/root"); got != "class1" {
+			t.Errorf("Got %q, want %q", got, "class1")
+		}
+		if _, err := fs.Open("style/missing"); err == nil {
+			t.Error("Expected error")
+		} else if _, ok := err.(*FileNotFound); !ok {
+			t.Errorf("Got %T, want *FileNotFound", err)
+		}
+	})
+
+	t.Run("Test FS File System - Read only", func(t *testing.T) {
+		fs := NewFSFileSystem(fsys, 0)
+		if _, err := fs.Create("main"); err == nil {
+			t.Error("Expected error")
+		}
+	})
+
+	t.Run("Test FS File System - List", func(t *testing.T) {
+		fs := NewFSFileSystem(fsys, 0)
+		names, err := fs.List("style")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != filepath.Join("style", "root") {
+			t.Errorf("Got %q, want [style/root]", names)
+		}
+	})
+
+	t.Run("Test FS File System - Polling watch", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "dirfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "main"), []byte("root"), 0644)
+
+		fs := NewFSFileSystem(os.DirFS(dir), time.Millisecond)
+		done := make(chan bool)
+		events, err := fs.Watch("main", done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ioutil.WriteFile(filepath.Join(dir, "main"), []byte("root\n\tchild"), 0644)
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Error("Expected change event")
+		}
+
+		close(done)
+		for range events {
+		}
+	})
+}
+
+func TestIOFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewSubFileSystem(NewOSFileSystem(), dir)
+	fsWrite(fs, "main", "root")
+	fsWrite(fs, filepath.Join("style", "root"), "class1")
+	fsWrite(fs, filepath.Join("svg", "icons", "eye"), "<svg></svg>")
+
+	t.Run("Test IO FS - Conformance", func(t *testing.T) {
+		if err := fstest.TestFS(NewIOFS(fs), "main", "style/root", "svg/icons/eye"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Test IO FS - Overlay", func(t *testing.T) {
+		kit := NewMemoryFileSystem()
+		fsWrite(kit, "style/button", "class2")
+		overlay := NewOverlayFileSystem(fs, kit)
+
+		entries, err := fsReadDir(NewIOFS(overlay), "style")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Name() != "button" || entries[1].Name() != "root" {
+			t.Errorf("Got %v, want [button root]", entries)
+		}
+	})
+}
+
+func fsReadDir(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(fsys, name)
+}
@@ -1,131 +1,476 @@
 package filesystem
 
 import (
-	"bytes"
-	"fmt"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MemoryFile provides an in-memory implementation of a file
 type MemoryFile struct {
 	entry  *MemoryFileEntry
-	buffer *bytes.Buffer
+	offset int64
+	closed bool
 }
 
+// MemoryFileEntry is the content of a file. Open files keep their entry after
+// it is renamed or removed, as OS files do
 type MemoryFileEntry struct {
 	mu       sync.RWMutex
-	content  string
-	watchers map[chan bool]struct{}
+	name     string
+	content  []byte
+	modTime  time.Time
+	removed  bool
+	watchers *memoryWatchers
+}
+
+// memoryWatchers are the watchers of each file name and directory tree of a
+// MemoryFileSystem. Watchers follow names rather than entries, so replacing a
+// file notifies them
+type memoryWatchers struct {
+	mu    sync.Mutex
+	names map[string]map[*memoryWatcher]struct{}
+	trees map[*memoryWatcher]string
+}
+
+// memoryWatcher delivers change events to a watcher in order, without
+// blocking writers
+type memoryWatcher struct {
+	mu      sync.Mutex
+	pending []Event
+	signal  chan struct{}
+}
+
+// newMemoryWatcher returns a memoryWatcher with no pending events
+func newMemoryWatcher() *memoryWatcher {
+	return &memoryWatcher{signal: make(chan struct{}, 1)}
+}
+
+// subscribe adds a watcher of a file name
+func (w *memoryWatchers) subscribe(name string, watcher *memoryWatcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watchers, ok := w.names[name]
+	if !ok {
+		watchers = make(map[*memoryWatcher]struct{})
+		w.names[name] = watchers
+	}
+	watchers[watcher] = struct{}{}
+}
+
+// unsubscribe removes a watcher of a file name, forgetting names left unwatched
+func (w *memoryWatchers) unsubscribe(name string, watcher *memoryWatcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.names[name], watcher)
+	if len(w.names[name]) == 0 {
+		delete(w.names, name)
+	}
+}
+
+// notify queues a change event for every watcher of a file name and every
+// watcher of a tree holding it
+func (w *memoryWatchers) notify(name string, op Op) {
+	event := Event{name, op}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for watcher := range w.names[name] {
+		watcher.queue(event)
+	}
+	for watcher, root := range w.trees {
+		if root == "." || strings.HasPrefix(name, root+string(filepath.Separator)) {
+			watcher.queue(event)
+		}
+	}
+}
+
+// queue adds an event to be delivered
+func (w *memoryWatcher) queue(event Event) {
+	w.mu.Lock()
+	w.pending = append(w.pending, event)
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// deliver calls send with each pending event until done, or until send
+// reports the watcher has finished
+func (w *memoryWatcher) deliver(done <-chan bool, send func(Event) bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.signal:
+		}
+
+		for {
+			w.mu.Lock()
+			if len(w.pending) == 0 {
+				w.mu.Unlock()
+				break
+			}
+			event := w.pending[0]
+			w.pending = w.pending[1:]
+			w.mu.Unlock()
+
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+// MemoryFileInfo describes a file or directory of a MemoryFileSystem
+type MemoryFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i MemoryFileInfo) Name() string       { return i.name }
+func (i MemoryFileInfo) Size() int64        { return i.size }
+func (i MemoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i MemoryFileInfo) IsDir() bool        { return i.dir }
+func (i MemoryFileInfo) Sys() interface{}   { return nil }
+
+func (i MemoryFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// info returns the FileInfo of an entry. Must be called with the entry locked
+func (e *MemoryFileEntry) info() MemoryFileInfo {
+	return MemoryFileInfo{
+		name:    filepath.Base(e.name),
+		size:    int64(len(e.content)),
+		modTime: e.modTime,
+	}
 }
 
 // Close the file
-func (p MemoryFile) Close() error {
+func (f *MemoryFile) Close() error {
+	if f.closed {
+		return f.error("close", os.ErrClosed)
+	}
+	f.closed = true
 	return nil
-	// panic("not implemented") // TODO: Implement
 }
 
-// Read the file
-func (f MemoryFile) Read(p []byte) (n int, err error) {
-	return f.buffer.Read(p)
+// error returns a PathError for an operation on the file, as OS files do
+func (f *MemoryFile) error(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.entry.name, Err: err}
 }
 
-func (f MemoryFile) Write(b []byte) (n int, err error) {
-	f.entry.mu.Lock()
-	defer f.entry.mu.Unlock()
-	f.buffer.Reset()
-	n, err = f.buffer.Write(b)
-	f.entry.content = string(b)
-	for watcher := range f.entry.watchers {
-		watcher <- true
+// Read the file from the current offset
+func (f *MemoryFile) Read(p []byte) (n int, err error) {
+	if f.closed {
+		return 0, f.error("read", os.ErrClosed)
 	}
+	n, err = f.ReadAt(p, f.offset)
+	f.offset += int64(n)
 	return n, err
 }
 
+// Write to the file at the current offset, notifying watchers
+func (f *MemoryFile) Write(b []byte) (n int, err error) {
+	if f.closed {
+		return 0, f.error("write", os.ErrClosed)
+	}
+
+	f.entry.mu.Lock()
+	end := f.offset + int64(len(b))
+	if end > int64(len(f.entry.content)) {
+		content := make([]byte, end)
+		copy(content, f.entry.content)
+		f.entry.content = content
+	}
+	copy(f.entry.content[f.offset:], b)
+	f.offset = end
+	f.entry.modTime = time.Now()
+	name, removed := f.entry.name, f.entry.removed
+	f.entry.mu.Unlock()
+
+	if !removed {
+		f.entry.watchers.notify(name, Modified)
+	}
+	return len(b), nil
+}
+
 // ReadAt a given offset with a file
-func (f MemoryFile) ReadAt(p []byte, off int64) (n int, err error) {
-	panic("not implemented") // TODO: Implement
+func (f *MemoryFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, f.error("read", os.ErrClosed)
+	}
+	if off < 0 {
+		return 0, f.error("readat", errors.New("negative offset"))
+	}
+
+	f.entry.mu.RLock()
+	defer f.entry.mu.RUnlock()
+
+	if off >= int64(len(f.entry.content)) {
+		return 0, io.EOF
+	}
+	n = copy(p, f.entry.content[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
-// Seek the file stub to a given position
-func (MemoryFile) Seek(offset int64, whence int) (int64, error) {
-	panic("not implemented") // TODO: Implement
+// Seek sets the offset of the next Read or Write
+func (f *MemoryFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, f.error("seek", os.ErrClosed)
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		f.entry.mu.RLock()
+		offset += int64(len(f.entry.content))
+		f.entry.mu.RUnlock()
+	case io.SeekStart:
+	default:
+		return 0, f.error("seek", os.ErrInvalid)
+	}
+	if offset < 0 {
+		return 0, f.error("seek", os.ErrInvalid)
+	}
+
+	f.offset = offset
+	return offset, nil
 }
 
-// Stat the file stub
-func (MemoryFile) Stat() (os.FileInfo, error) {
-	panic("not implemented") // TODO: Implement
+// Stat returns the FileInfo of the file
+func (f *MemoryFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, f.error("stat", os.ErrClosed)
+	}
+	f.entry.mu.RLock()
+	defer f.entry.mu.RUnlock()
+	return f.entry.info(), nil
 }
 
 // MemoryFileSystem implements an in-memory File System
 type MemoryFileSystem struct {
-	files map[string]*MemoryFileEntry
+	mu       *sync.RWMutex
+	files    map[string]*MemoryFileEntry
+	watchers *memoryWatchers
 }
 
 func NewMemoryFileSystem() *MemoryFileSystem {
 	return &MemoryFileSystem{
+		&sync.RWMutex{},
 		make(map[string]*MemoryFileEntry),
+		&memoryWatchers{
+			names: make(map[string]map[*memoryWatcher]struct{}),
+			trees: make(map[*memoryWatcher]string),
+		},
 	}
 }
 
-// Create a file
+// Create a file, truncating it if it already exists
 func (fs MemoryFileSystem) Create(name string) (File, error) {
+	name = filepath.Clean(name)
+
+	fs.mu.Lock()
 	entry, ok := fs.files[name]
 	if !ok {
-		// ch := make(chan bool)
-
-		fs.files[name] = &MemoryFileEntry{
-			sync.RWMutex{},
-			"",
-			make(map[chan bool]struct{}),
+		entry = &MemoryFileEntry{
+			name:     name,
+			watchers: fs.watchers,
 		}
-		entry = fs.files[name]
+		fs.files[name] = entry
 	}
-	return MemoryFile{
-		entry,
-		bytes.NewBufferString(entry.content),
-	}, nil
+	fs.mu.Unlock()
+
+	entry.mu.Lock()
+	entry.content = []byte{}
+	entry.modTime = time.Now()
+	entry.mu.Unlock()
+
+	// Watchers of a removed file learn it has been created again
+	if !ok {
+		fs.watchers.notify(name, Created)
+	}
+	return &MemoryFile{entry: entry}, nil
 }
 
 // Open a file
 func (fs MemoryFileSystem) Open(name string) (File, error) {
-	entry, ok := fs.files[name]
+	fs.mu.RLock()
+	entry, ok := fs.files[filepath.Clean(name)]
+	fs.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("File not found: %q", name)
+		return nil, &FileNotFound{name}
 	}
-	return MemoryFile{
-		entry,
-		bytes.NewBufferString(entry.content),
-	}, nil
+	return &MemoryFile{entry: entry}, nil
 }
 
-// Stat - Not implemented
-func (MemoryFileSystem) Stat(name string) (os.FileInfo, error) { panic("not implemented") }
+// Stat returns the FileInfo of a file, or of a directory holding files
+func (fs MemoryFileSystem) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
 
-// Watch a file for changes, returns a receiving channel for notifying of change events
-func (fs MemoryFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
-	files := make(chan bool)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 
-	entry, ok := fs.files[name]
+	if entry, ok := fs.files[name]; ok {
+		entry.mu.RLock()
+		defer entry.mu.RUnlock()
+		return entry.info(), nil
+	}
+
+	for path, entry := range fs.files {
+		if name == "." || strings.HasPrefix(path, name+string(filepath.Separator)) {
+			entry.mu.RLock()
+			defer entry.mu.RUnlock()
+			return MemoryFileInfo{
+				name:    filepath.Base(name),
+				modTime: entry.modTime,
+				dir:     true,
+			}, nil
+		}
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// Rename a file, replacing any existing file of the new name. Watchers of
+// both names are notified
+func (fs MemoryFileSystem) Rename(oldname string, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+
+	fs.mu.Lock()
+	entry, ok := fs.files[oldname]
 	if !ok {
-		return nil, fmt.Errorf("File not found: %q", name)
+		fs.mu.Unlock()
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if oldname == newname {
+		fs.mu.Unlock()
+		return nil
 	}
+	if replaced, ok := fs.files[newname]; ok {
+		replaced.mu.Lock()
+		replaced.removed = true
+		replaced.mu.Unlock()
+	}
+	delete(fs.files, oldname)
+	fs.files[newname] = entry
+	entry.mu.Lock()
+	entry.name = newname
+	entry.mu.Unlock()
+	fs.mu.Unlock()
 
+	fs.watchers.notify(oldname, Renamed)
+	fs.watchers.notify(newname, Created)
+	return nil
+}
+
+// Remove a file, notifying its watchers
+func (fs MemoryFileSystem) Remove(name string) error {
+	name = filepath.Clean(name)
+
+	fs.mu.Lock()
+	entry, ok := fs.files[name]
+	if !ok {
+		fs.mu.Unlock()
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, name)
 	entry.mu.Lock()
-	entry.watchers[files] = struct{}{}
+	entry.removed = true
 	entry.mu.Unlock()
+	fs.mu.Unlock()
+
+	fs.watchers.notify(name, Deleted)
+	return nil
+}
+
+// Watch a file for changes, returns a receiving channel for notifying of
+// change events. Watchers are notified when the file is written, replaced,
+// removed or created again
+func (fs MemoryFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	name = filepath.Clean(name)
+
+	fs.mu.RLock()
+	_, ok := fs.files[name]
+	fs.mu.RUnlock()
+	if !ok {
+		return nil, &FileNotFound{name}
+	}
+
+	files := make(chan bool)
+	watcher := newMemoryWatcher()
+	fs.watchers.subscribe(name, watcher)
 
 	go func() {
-		<-done
-		go func() {
-			for range files {
+		watcher.deliver(done, func(Event) bool {
+			select {
+			case files <- true:
+				return true
+			case <-done:
+				return false
 			}
-		}()
-		entry.mu.Lock()
-		delete(entry.watchers, files)
-		entry.mu.Unlock()
+		})
+		fs.watchers.unsubscribe(name, watcher)
 		close(files)
 	}()
 
 	return files, nil
 }
+
+// WatchTree reports changes to every file beneath a directory until done
+func (fs MemoryFileSystem) WatchTree(root string, done <-chan bool) (<-chan Event, error) {
+	events := make(chan Event)
+	watcher := newMemoryWatcher()
+	fs.watchers.mu.Lock()
+	fs.watchers.trees[watcher] = filepath.Clean(root)
+	fs.watchers.mu.Unlock()
+
+	go func() {
+		watcher.deliver(done, func(event Event) bool {
+			select {
+			case events <- event:
+				return true
+			case <-done:
+				return false
+			}
+		})
+		fs.watchers.mu.Lock()
+		delete(fs.watchers.trees, watcher)
+		fs.watchers.mu.Unlock()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// List returns the names of all files beneath a directory
+func (fs MemoryFileSystem) List(root string) ([]string, error) {
+	dir := filepath.ToSlash(filepath.Clean(root))
+	names := []string{}
+
+	fs.mu.RLock()
+	for name := range fs.files {
+		if dir == "." || strings.HasPrefix(filepath.ToSlash(name), dir+"/") {
+			names = append(names, name)
+		}
+	}
+	fs.mu.RUnlock()
+
+	sort.Strings(names)
+	return names, nil
+}
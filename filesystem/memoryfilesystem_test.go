@@ -145,6 +145,26 @@ func TestMemoryFileSystem(t *testing.T) {
 		close(done)
 	})
 
+	t.Run("Test Memory File System - Watchers forgotten", func(t *testing.T) {
+		fs := NewMemoryFileSystem()
+		fsWrite(fs, filename, "Initial content")
+		done := make(chan bool)
+		watch, _ := fs.Watch(filename, done)
+
+		for i := 0; i < 1000; i++ {
+			if err := WriteFile(fs, filename, []byte("content")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(done)
+		for range watch {
+		}
+
+		if n := len(fs.watchers.names); n != 0 {
+			t.Errorf("Got %d watched names, want 0", n)
+		}
+	})
+
 }
 
 func fsWrite(fs FileSystem, name string, content string) {
@@ -5,18 +5,37 @@ package filesystem
 import (
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// OSFileSystem implements FileSystem, exposing the OS file system
-type OSFileSystem struct{}
+// OSFileSystem implements FileSystem, exposing the OS file system. Changes are
+// reported by native notifications, or by polling when an interval is set or
+// notifications are unavailable
+type OSFileSystem struct {
+	interval time.Duration
+}
 
 func NewOSFileSystem() *OSFileSystem {
 	return &OSFileSystem{}
 }
 
-func (OSFileSystem) Create(name string) (File, error) { return os.Create(name) }
+// NewPollingFileSystem returns an OS file system polling for changes every
+// interval, for network file systems and containers where native
+// notifications are missed
+func NewPollingFileSystem(interval time.Duration) *OSFileSystem {
+	return &OSFileSystem{interval}
+}
+
+// Create a file, creating any missing parent directories
+func (OSFileSystem) Create(name string) (File, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
 
 func (OSFileSystem) Open(name string) (File, error) {
 	file, err := os.Open(name)
@@ -32,53 +51,180 @@ func (OSFileSystem) Open(name string) (File, error) {
 }
 func (OSFileSystem) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 
+// Rename a file, creating any missing parent directories of the new name
+func (OSFileSystem) Rename(oldname string, newname string) error {
+	if err := os.MkdirAll(filepath.Dir(newname), 0755); err != nil {
+		return err
+	}
+	return os.Rename(oldname, newname)
+}
+
+// Remove a file
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Watch a file for changes. The parent directory is watched so the file is
+// still followed once replaced, removed or created again
 func (fs OSFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	if !FileExist(name) {
+		return nil, &FileNotFound{name}
+	}
+	if fs.interval > 0 {
+		return pollWatch(name, fs.interval, done)
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return nil, err
+		log.Printf("Polling %s: %v", name, err)
+		return pollWatch(name, DefaultPollInterval, done)
+	}
+	if err := watcher.Add(filepath.Dir(name)); err != nil {
+		watcher.Close()
+		log.Printf("Polling %s: %v", name, err)
+		return pollWatch(name, DefaultPollInterval, done)
 	}
 
 	files := make(chan bool)
+	target := filepath.Clean(name)
 
 	go func() {
+		defer close(files)
+		defer watcher.Close()
 		for {
 			select {
 			case <-done:
-				watcher.Close()
-				close(files)
 				return
+			case err := <-watcher.Errors:
+				log.Println("error:", err)
 			case event := <-watcher.Events:
+				if filepath.Clean(event.Name) != target || event.Op == fsnotify.Chmod {
+					continue
+				}
 				log.Printf("event:%s,%s", event.Name, event.Op)
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					if FileExist(name) {
-						log.Printf("Reread file:%s ", name)
-						err := watcher.Add(name)
-						if err != nil {
-							log.Println("error:", err)
-						}
-					}
+				select {
+				case files <- true:
+				case <-done:
+					return
 				}
-				// only work on WRITE events of the original filename
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					log.Println("modified file:", event.Name)
+			}
+		}
+	}()
+
+	return files, nil
+}
+
+// WatchTree reports changes to every file beneath a directory until done,
+// using a single watcher. Directories created later are watched as they appear
+func (fs OSFileSystem) WatchTree(root string, done <-chan bool) (<-chan Event, error) {
+	if fs.interval > 0 {
+		return pollTree(root, fs.interval, done)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Polling %s: %v", root, err)
+		return pollTree(root, DefaultPollInterval, done)
+	}
+
+	// addTree watches a directory and those beneath it, calling fn with each file
+	addTree := func(dir string, fn func(string)) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return watcher.Add(path)
+			}
+			fn(path)
+			return nil
+		})
+	}
+	if err := addTree(root, func(string) {}); err != nil {
+		watcher.Close()
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		log.Printf("Polling %s: %v", root, err)
+		return pollTree(root, DefaultPollInterval, done)
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+
+		send := func(event Event) bool {
+			select {
+			case events <- event:
+				return true
+			case <-done:
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-done:
+				return
+			case err := <-watcher.Errors:
+				log.Println("error:", err)
+			case event := <-watcher.Events:
+				var op Op
+				switch {
+				case event.Op&fsnotify.Create == fsnotify.Create:
+					op = Created
+				case event.Op&fsnotify.Write == fsnotify.Write:
+					op = Modified
+				case event.Op&fsnotify.Remove == fsnotify.Remove:
+					op = Deleted
+				case event.Op&fsnotify.Rename == fsnotify.Rename:
+					op = Renamed
+				default:
+					continue
 				}
 
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Rename == fsnotify.Rename {
-					log.Println("File system write:", name)
-					files <- true
+				// Report the files of new directories, which may have been
+				// filled before the directory was watched
+				if info, err := os.Stat(event.Name); op == Created && err == nil && info.IsDir() {
+					files := []string{}
+					if err := addTree(event.Name, func(path string) { files = append(files, path) }); err != nil {
+						log.Println("error:", err)
+					}
+					for _, path := range files {
+						if !send(Event{path, Created}) {
+							return
+						}
+					}
+					continue
 				}
 
+				if !send(Event{event.Name, op}) {
+					return
+				}
 			}
 		}
 	}()
 
-	err = watcher.Add(name)
-	if err != nil {
-		return nil, err
-		// log.Fatal(err)
-	}
+	return events, nil
+}
 
-	return files, nil
+// List returns the paths of all files beneath a directory
+func (OSFileSystem) List(root string) ([]string, error) {
+	names := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	return names, err
 }
 
 func FileExist(file string) bool {
@@ -15,7 +15,7 @@ func TestOSFileSystem(t *testing.T) {
 		filename := tempMkFile(t, "", "testfile")
 		fs := NewOSFileSystem()
 
-		WriteFile(t, filename, want)
+		appendFile(t, filename, want)
 		file, err := fs.Open(filename)
 		if err != nil {
 			t.Error(err)
@@ -42,14 +42,14 @@ func TestOSFileSystem(t *testing.T) {
 		done := make(chan bool)
 
 		// Write initial file value
-		WriteFile(t, filename, content)
+		appendFile(t, filename, content)
 
 		// Watch file for modifications, receiving events
 		events, _ := fs.Watch(filename, done)
 
 		// Modify file
 
-		WriteFile(t, filename, newContent)
+		appendFile(t, filename, newContent)
 
 		// Receive modification event
 		_, ok := <-events
@@ -76,7 +76,7 @@ func TestOSFileSystem(t *testing.T) {
 		done := make(chan bool)
 
 		// Write initial file value
-		WriteFile(t, filename, content)
+		appendFile(t, filename, content)
 
 		// Watch file for modifications, receiving events
 		events, _ := fs.Watch(filename, done)
@@ -87,7 +87,7 @@ func TestOSFileSystem(t *testing.T) {
 		// time.Sleep(1)
 
 		// Modify file
-		WriteFile(t, filename, newContent)
+		appendFile(t, filename, newContent)
 
 		// Receive modification event
 		_, ok := <-events
@@ -117,7 +117,7 @@ func tempMkFile(t *testing.T, dir string, filename string) string {
 	return f.Name()
 }
 
-func WriteFile(t *testing.T, filename string, body string) {
+func appendFile(t *testing.T, filename string, body string) {
 	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 777)
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,351 @@
+package filesystem
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// SubFileSystem exposes a directory of a file system as its root
+type SubFileSystem struct {
+	fs  FileSystem
+	dir string
+}
+
+// NewSubFileSystem returns a file system rooted at a directory of fs
+func NewSubFileSystem(fs FileSystem, dir string) *SubFileSystem {
+	return &SubFileSystem{fs, dir}
+}
+
+// Create a file
+func (s SubFileSystem) Create(name string) (File, error) {
+	return s.fs.Create(filepath.Join(s.dir, name))
+}
+
+// Open a file
+func (s SubFileSystem) Open(name string) (File, error) {
+	file, err := s.fs.Open(filepath.Join(s.dir, name))
+	if _, ok := err.(*FileNotFound); ok {
+		return nil, &FileNotFound{name}
+	}
+	return file, err
+}
+
+// Stat a file
+func (s SubFileSystem) Stat(name string) (os.FileInfo, error) {
+	return s.fs.Stat(filepath.Join(s.dir, name))
+}
+
+// Rename a file
+func (s SubFileSystem) Rename(oldname string, newname string) error {
+	return s.fs.Rename(filepath.Join(s.dir, oldname), filepath.Join(s.dir, newname))
+}
+
+// Remove a file
+func (s SubFileSystem) Remove(name string) error {
+	return s.fs.Remove(filepath.Join(s.dir, name))
+}
+
+// Watch a file for changes
+func (s SubFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	return s.fs.Watch(filepath.Join(s.dir, name), done)
+}
+
+// WatchTree reports changes to every file beneath a directory, named relative
+// to the root
+func (s SubFileSystem) WatchTree(root string, done <-chan bool) (<-chan Event, error) {
+	events, err := s.fs.WatchTree(filepath.Join(s.dir, root), done)
+	if err != nil {
+		return nil, err
+	}
+
+	relative := make(chan Event)
+	go func() {
+		defer close(relative)
+		for event := range events {
+			name, err := filepath.Rel(s.dir, event.Name)
+			if err != nil {
+				continue
+			}
+			select {
+			case relative <- Event{name, event.Op}:
+			case <-done:
+			}
+		}
+	}()
+	return relative, nil
+}
+
+// List returns the names of all files beneath a directory, relative to the root
+func (s SubFileSystem) List(root string) ([]string, error) {
+	paths, err := s.fs.List(filepath.Join(s.dir, root))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		name, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// OverlayFileSystem reads through an ordered list of layers, the first layer
+// holding a file shadowing the rest. Files are only ever written to the top
+// layer
+type OverlayFileSystem struct {
+	layers   []FileSystem
+	mu       sync.Mutex
+	watchers map[string][]*overlayWatcher
+}
+
+// overlayWatcher merges the change events of a file from every layer
+type overlayWatcher struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	events  chan bool
+	done    <-chan bool
+	top     bool
+	stopped bool
+}
+
+// NewOverlayFileSystem returns a file system layering the given file systems,
+// highest priority first
+func NewOverlayFileSystem(layers ...FileSystem) *OverlayFileSystem {
+	return &OverlayFileSystem{
+		layers:   layers,
+		watchers: make(map[string][]*overlayWatcher),
+	}
+}
+
+// Create a file in the top layer. A file previously only found in lower
+// layers is watched in the top layer from then on
+func (o *OverlayFileSystem) Create(name string) (File, error) {
+	file, err := o.layers[0].Create(name)
+	if err != nil {
+		return nil, err
+	}
+	o.uncover(name)
+	return file, nil
+}
+
+// uncover watches a file in the top layer for watchers previously only
+// following it in lower layers, returning those watchers
+func (o *OverlayFileSystem) uncover(name string) []*overlayWatcher {
+	o.mu.Lock()
+	uncovered := []*overlayWatcher{}
+	for _, w := range o.watchers[name] {
+		if !w.top {
+			w.top = true
+			uncovered = append(uncovered, w)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, w := range uncovered {
+		if events, err := o.layers[0].Watch(name, w.done); err == nil {
+			w.forward(events)
+		}
+	}
+	return uncovered
+}
+
+// Open a file from the first layer holding it
+func (o *OverlayFileSystem) Open(name string) (File, error) {
+	for _, layer := range o.layers {
+		file, err := layer.Open(name)
+		if _, ok := err.(*FileNotFound); ok {
+			continue
+		}
+		return file, err
+	}
+	return nil, &FileNotFound{name}
+}
+
+// Stat a file in the first layer holding it
+func (o *OverlayFileSystem) Stat(name string) (os.FileInfo, error) {
+	var err error
+	for _, layer := range o.layers {
+		var info os.FileInfo
+		if info, err = layer.Stat(name); err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+// Rename a file in the top layer. Watchers of the new name only following it
+// in lower layers are notified, the change having happened before their top
+// layer watch
+func (o *OverlayFileSystem) Rename(oldname string, newname string) error {
+	if err := o.layers[0].Rename(oldname, newname); err != nil {
+		return err
+	}
+	for _, w := range o.uncover(newname) {
+		changed := make(chan bool, 1)
+		changed <- true
+		close(changed)
+		w.forward(changed)
+	}
+	return nil
+}
+
+// Remove a file from the top layer, uncovering any copy in lower layers
+func (o *OverlayFileSystem) Remove(name string) error {
+	return o.layers[0].Remove(name)
+}
+
+// Watch a file in every layer holding it, merging their change events
+func (o *OverlayFileSystem) Watch(name string, done <-chan bool) (<-chan bool, error) {
+	w := &overlayWatcher{
+		events: make(chan bool),
+		done:   done,
+	}
+
+	var err error
+	watched := false
+	for i, layer := range o.layers {
+		events, e := layer.Watch(name, done)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		watched = true
+		w.top = w.top || i == 0
+		w.forward(events)
+	}
+	if !watched {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	o.watchers[name] = append(o.watchers[name], w)
+	o.mu.Unlock()
+
+	go func() {
+		<-done
+		w.mu.Lock()
+		w.stopped = true
+		w.mu.Unlock()
+
+		o.mu.Lock()
+		watchers := o.watchers[name]
+		for i := range watchers {
+			if watchers[i] == w {
+				o.watchers[name] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(o.watchers[name]) == 0 {
+			delete(o.watchers, name)
+		}
+		o.mu.Unlock()
+
+		w.wg.Wait()
+		close(w.events)
+	}()
+
+	return w.events, nil
+}
+
+// WatchTree reports changes to every file beneath a directory in any layer,
+// except changes to files shadowed by a higher layer. Layers that can't be
+// watched are skipped unless none can
+func (o *OverlayFileSystem) WatchTree(root string, done <-chan bool) (<-chan Event, error) {
+	var wg sync.WaitGroup
+	var err error
+	events := make(chan Event)
+
+	watched := false
+	for i, layer := range o.layers {
+		layerEvents, e := layer.WatchTree(root, done)
+		if e != nil {
+			log.Printf("Layer not watched: %v", e)
+			err = e
+			continue
+		}
+		watched = true
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for event := range layerEvents {
+				if o.shadowed(event.Name, i) {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-done:
+				}
+			}
+		}(i)
+	}
+	if !watched {
+		return nil, err
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events, nil
+}
+
+// shadowed returns whether a layer above the given one holds a file
+func (o *OverlayFileSystem) shadowed(name string, layer int) bool {
+	for _, above := range o.layers[:layer] {
+		if _, err := above.Stat(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// forward sends the events of a layer to the merged channel until done
+func (w *overlayWatcher) forward(events <-chan bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for range events {
+			select {
+			case w.events <- true:
+			case <-w.done:
+			}
+		}
+	}()
+}
+
+// List returns the names of all files beneath a directory in any layer
+func (o *OverlayFileSystem) List(root string) ([]string, error) {
+	seen := map[string]struct{}{}
+	for _, layer := range o.layers {
+		names, err := layer.List(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			seen[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,118 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, fs FileSystem, name string) string {
+	file, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, _ := ioutil.ReadAll(file)
+	return string(data)
+}
+
+func TestOverlayFileSystem(t *testing.T) {
+	project := NewMemoryFileSystem()
+	kit := NewMemoryFileSystem()
+	fsWrite(project, "project/main", "root")
+	fsWrite(kit, "kit/style/root", "class1")
+	fsWrite(kit, "kit/style/button", "class2")
+	fsWrite(project, "project/style/root", "class3")
+
+	fs := NewOverlayFileSystem(
+		NewSubFileSystem(project, "project"),
+		NewSubFileSystem(kit, "kit"),
+	)
+
+	t.Run("Test Overlay File System - Open", func(t *testing.T) {
+		if got := readAll(t, fs, "style/button"); got != "class2" {
+			t.Errorf("Got %q, want %q from the kit", got, "class2")
+		}
+		if got := readAll(t, fs, "style/root"); got != "class3" {
+			t.Errorf("Got %q, want %q from the project", got, "class3")
+		}
+		if _, err := fs.Open("style/missing"); err == nil {
+			t.Error("Expected error")
+		} else if _, ok := err.(*FileNotFound); !ok {
+			t.Errorf("Got %T, want *FileNotFound", err)
+		}
+	})
+
+	t.Run("Test Overlay File System - List", func(t *testing.T) {
+		names, err := fs.List("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"main", "style/button", "style/root"}
+		if len(names) != len(want) {
+			t.Fatalf("Got %q, want %q", names, want)
+		}
+		for i := range want {
+			if names[i] != want[i] {
+				t.Errorf("Got %q, want %q", names, want)
+			}
+		}
+	})
+
+	t.Run("Test Overlay File System - Override and watch", func(t *testing.T) {
+		done := make(chan bool)
+		defer close(done)
+		events, err := fs.Watch("style/button", done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fsWrite(fs, "style/button", "class4")
+
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("Expected change event from the top layer")
+		}
+		if got := readAll(t, fs, "style/button"); got != "class4" {
+			t.Errorf("Got %q, want %q", got, "class4")
+		}
+		if got := readAll(t, kit, "kit/style/button"); got != "class2" {
+			t.Errorf("Kit changed to %q, want %q", got, "class2")
+		}
+	})
+
+	t.Run("Test Overlay File System - Shadowed tree events", func(t *testing.T) {
+		fsWrite(kit, "kit/style/card", "class5")
+		done := make(chan bool)
+		defer close(done)
+		events, err := fs.WatchTree("style", done)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The project's root style shadows the kit's, so only the card is reported
+		kit.Remove("kit/style/root")
+		kit.Remove("kit/style/card")
+
+		select {
+		case event := <-events:
+			if event.Name != "style/card" || event.Op != Deleted {
+				t.Errorf("Got %v, want style/card deleted", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected delete event from the kit")
+		}
+	})
+
+	t.Run("Test Overlay File System - Watch cancellation", func(t *testing.T) {
+		done := make(chan bool)
+		events, err := fs.Watch("style/root", done)
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(done)
+		for range events {
+		}
+	})
+}
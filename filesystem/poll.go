@@ -0,0 +1,205 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultPollInterval is how often files are polled when native file system
+// notifications are unavailable
+const DefaultPollInterval = time.Second
+
+// recentWindow is how long after a modification a file's content is hashed on
+// every poll, catching changes within the mod time resolution of some file
+// systems
+const recentWindow = 2 * time.Second
+
+// fileState is what polling compares to detect a change to a file
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// statFile returns the state of a file, hashing its content
+func statFile(name string, info os.FileInfo) (fileState, error) {
+	state := fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return state, err
+	}
+	state.hash = sha256.Sum256(data)
+	return state, nil
+}
+
+// changed reports whether a file differs from a previous state, returning its
+// new state. Content is only hashed when the size and mod time don't already
+// tell, or the file was modified recently
+func (previous fileState) changed(name string, info os.FileInfo) (fileState, bool) {
+	if info.Size() == previous.size && info.ModTime().Equal(previous.modTime) &&
+		time.Since(info.ModTime()) > recentWindow {
+		return previous, false
+	}
+
+	state, err := statFile(name, info)
+	if err != nil {
+		return previous, false
+	}
+	return state, state.hash != previous.hash
+}
+
+// pollWatch reports changes to a file every interval until done, including
+// its removal and creation again
+func pollWatch(name string, interval time.Duration, done <-chan bool) (<-chan bool, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, &FileNotFound{name}
+	}
+	state, err := statFile(name, info)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(chan bool)
+	go func() {
+		defer close(files)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		exists := true
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			changed := false
+			info, err := os.Stat(name)
+			switch {
+			case err != nil:
+				changed, exists = exists, false
+			case !exists:
+				exists = true
+				state, _ = statFile(name, info)
+				changed = true
+			default:
+				state, changed = state.changed(name, info)
+			}
+			if !changed {
+				continue
+			}
+
+			select {
+			case files <- true:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return files, nil
+}
+
+// snapshotTree returns the state of every file beneath a directory
+func snapshotTree(root string, previous map[string]fileState) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files removed while walking are reported on the next poll
+			if os.IsNotExist(err) && path != root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if state, ok := previous[path]; ok {
+			files[path], _ = state.changed(path, info)
+		} else if state, err := statFile(path, info); err == nil {
+			files[path] = state
+		}
+		return nil
+	})
+	return files, err
+}
+
+// pollTree reports changes to every file beneath a directory every interval
+// until done. A removed file is reported as renamed when its content appears
+// under a new name in the same poll
+func pollTree(root string, interval time.Duration, done <-chan bool) (<-chan Event, error) {
+	files, err := snapshotTree(root, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			latest, err := snapshotTree(root, files)
+			if err != nil {
+				log.Println("error:", err)
+				continue
+			}
+
+			changes := []Event{}
+			created := map[[sha256.Size]byte]bool{}
+			for path, state := range latest {
+				if previous, ok := files[path]; !ok {
+					changes = append(changes, Event{path, Created})
+					created[state.hash] = true
+				} else if state.hash != previous.hash {
+					changes = append(changes, Event{path, Modified})
+				}
+			}
+			// Files gone with their content created elsewhere were renamed
+			for path, state := range files {
+				if _, ok := latest[path]; ok {
+					continue
+				}
+				if created[state.hash] {
+					changes = append(changes, Event{path, Renamed})
+				} else {
+					changes = append(changes, Event{path, Deleted})
+				}
+			}
+			files = latest
+
+			// Report removals first, as a renamed file leaves its old name
+			// before appearing under the new one
+			removed := func(op Op) bool { return op == Renamed || op == Deleted }
+			sort.Slice(changes, func(i, j int) bool {
+				if removed(changes[i].Op) != removed(changes[j].Op) {
+					return removed(changes[i].Op)
+				}
+				return changes[i].Name < changes[j].Name
+			})
+			for _, change := range changes {
+				select {
+				case events <- change:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
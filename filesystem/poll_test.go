@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPollWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "main")
+	old := time.Now().Add(-time.Hour)
+	if err := ioutil.WriteFile(name, []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	events, err := pollWatch(name, 10*time.Millisecond, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Test Poll Watch - Unchanged content", func(t *testing.T) {
+		now := time.Now()
+		if err := os.Chtimes(name, now, now); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-events:
+			t.Error("Unexpected event for a file only touched")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Test Poll Watch - Same size and mod time", func(t *testing.T) {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("main"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, info.ModTime(), info.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-events:
+		case <-time.After(2 * time.Second):
+			t.Error("Expected event for changed content")
+		}
+	})
+
+	t.Run("Test Poll Watch - Missing file", func(t *testing.T) {
+		if _, err := pollWatch(filepath.Join(dir, "missing"), time.Millisecond, done); err == nil {
+			t.Error("Expected error")
+		} else if _, ok := err.(*FileNotFound); !ok {
+			t.Errorf("Got %T, want *FileNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package filesystem
+
+// Op is the kind of change reported by WatchTree
+type Op int
+
+// WatchTree operations. A renamed file is reported under its old name, its
+// new name is reported as created
+const (
+	Created Op = iota
+	Modified
+	Deleted
+	Renamed
+)
+
+var opNames = map[Op]string{
+	Created:  "created",
+	Modified: "modified",
+	Deleted:  "deleted",
+	Renamed:  "renamed",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// Event is a change to a file beneath a watched directory
+type Event struct {
+	Name string
+	Op   Op
+}
@@ -1,6 +1,6 @@
 module scritti
 
-go 1.15
+go 1.16
 
 require (
 	github.com/fsnotify/fsnotify v1.4.9
@@ -3,12 +3,60 @@
 package main
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"scritti/core"
 	"scritti/filesystem"
+	"strings"
 	"syscall/js"
 )
 
+// defaultBundle is the bundle loaded at startup unless scrittiBundle is set
+const defaultBundle = "www/export.json"
+
+// loadBundle fetches a bundle relative to the page and imports it into store.
+// The browser's fetch is used rather than net/http, which would triple the
+// size of the module
+func loadBundle(store core.AssetStore, path string) error {
+	resp, err := await(js.Global().Call("fetch", path))
+	if err != nil {
+		return err
+	}
+	if !resp.Get("ok").Bool() {
+		return fmt.Errorf("Loading bundle %q: %d %s", path, resp.Get("status").Int(), resp.Get("statusText").String())
+	}
+	text, err := await(resp.Call("text"))
+	if err != nil {
+		return err
+	}
+	return core.ImportBundle(store, strings.NewReader(text.String()))
+}
+
+// await blocks until a JavaScript promise settles, returning its value or
+// rejection. Must not be called from the event loop, such as a js.Func
+func await(promise js.Value) (js.Value, error) {
+	values := make(chan js.Value, 1)
+	errs := make(chan error, 1)
+	resolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		values <- args[0]
+		return nil
+	})
+	defer resolve.Release()
+	reject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		errs <- errors.New(args[0].Call("toString").String())
+		return nil
+	})
+	defer reject.Release()
+
+	promise.Call("then", resolve, reject)
+	select {
+	case value := <-values:
+		return value, nil
+	case err := <-errs:
+		return js.Undefined(), err
+	}
+}
+
 func main() {
 	fs := filesystem.NewMemoryFileSystem()
 	store := core.NewFileStore(fs, "")
@@ -37,14 +85,13 @@ func main() {
 			println("View source")
 			println(v.Source)
 			println(len(v.Source))
-			buffer := new(bytes.Buffer)
-			err = core.RenderComponent(buffer, v, store.Get)
+			html, _, err := store.Render(cost)
 			if err != nil {
 				return js.Error{js.ValueOf(err.Error())}
 			}
 			result = map[string]interface{}{
 				"id":     params,
-				"html":   buffer.String(),
+				"html":   html,
 				"source": v.Source,
 			}
 		case core.SVG:
@@ -86,5 +133,22 @@ func main() {
 		return js.Undefined()
 	}))
 
+	// scrittiReady resolves once the startup bundle has been loaded
+	bundle := defaultBundle
+	if v := js.Global().Get("scrittiBundle"); v.Type() == js.TypeString {
+		bundle = v.String()
+	}
+	js.Global().Set("scrittiReady", js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resolve, reject := args[0], args[1]
+		go func() {
+			if err := loadBundle(store, bundle); err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke()
+		}()
+		return nil
+	})))
+
 	<-make(chan bool)
 }
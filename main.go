@@ -1,13 +1,240 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	iofs "io/fs"
 	"log"
+	"os"
+	core "scritti/core"
+	"scritti/filesystem"
 	server "scritti/server"
+	"strings"
+	"time"
 )
 
+const usage = `Usage: scritti [command] [flags]
+
+Commands:
+  serve                 Start the development server (default)
+  snapshot NAME         Save the project as a named snapshot
+  diff FROM [TO]        Compare a snapshot to another, or to the working copy
+  export [FILE]         Write the project as a JSON bundle, to stdout by default
+  import FILE           Add the assets of a JSON bundle to the project
+`
+
+// stringList is a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// openProject returns the file system of a project directory or archive,
+// rooted at the project. Archives are opened in memory, changes to them are
+// not saved. Directories are polled for changes every interval, if set
+func openProject(path string, interval time.Duration) (filesystem.FileSystem, error) {
+	if filesystem.IsArchive(path) {
+		return filesystem.NewArchiveFileSystem(path)
+	}
+	if interval > 0 {
+		return filesystem.NewSubFileSystem(filesystem.NewPollingFileSystem(interval), path), nil
+	}
+	return filesystem.NewSubFileSystem(filesystem.NewOSFileSystem(), path), nil
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	port := 9090
-	server.Server(port)
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	project := flags.String("project", "sampledata", "project directory, or .zip or .tar.gz archive")
+	port := flags.Int("port", 9090, "server port")
+	assets := flags.String("assets", "", "serve web assets from a directory, such as www, instead of the binary")
+	poll := flags.Duration("poll", 0, "poll for file changes at this interval, for network file systems and containers")
+	loadMode := flags.String("load", "lazy", "load assets when first requested (lazy) or all before serving (eager)")
+	workers := flags.Int("workers", 0, "assets loaded concurrently in eager mode (default one per CPU)")
+	capacity := flags.Int("capacity", 0, "most assets held in memory, evicting the least recently used (default unlimited)")
+	queue := flags.Int("queue", core.DefaultQueueSize, "change events queued for each subscriber")
+	overflow := flags.String("overflow", "coalesce", "when a subscriber's queue is full: drop-oldest, coalesce or disconnect")
+	var kits stringList
+	flags.Var(&kits, "kit", "shared style and SVG kit, directory or archive (repeatable)")
+	flags.Parse(args)
+
+	mode, err := core.ParseLoadMode(*loadMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	policy, err := core.ParseOverflowPolicy(*overflow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	fs, err := openProject(*project, *poll)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Shared kits are read beneath the project, which overrides their assets
+	if len(kits) > 0 {
+		layers := []filesystem.FileSystem{fs}
+		for _, kit := range kits {
+			layer, err := openProject(kit, *poll)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			layers = append(layers, layer)
+		}
+		fs = filesystem.NewOverlayFileSystem(layers...)
+	}
+
+	store := core.NewFileStore(fs, "")
+	store.SetCapacity(*capacity)
+	store.SetOverflow(*queue, policy)
+	defer store.Close()
+
+	switch command {
+	case "serve":
+		if mode == core.Eager {
+			preload(store, *workers)
+		}
+		var files iofs.FS
+		if len(*assets) > 0 {
+			files = os.DirFS(*assets)
+		}
+		server.Server(*port, store, files)
+	case "snapshot":
+		err = snapshot(store, flags.Args())
+	case "diff":
+		err = diff(store, flags.Args())
+	case "export":
+		err = export(store, flags.Args())
+	case "import":
+		err = load(store, flags.Args())
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		store.Close()
+		os.Exit(1)
+	}
+}
+
+// preload loads every asset before serving, reporting progress and any
+// assets that failed to load
+func preload(store *core.FileStore, workers int) {
+	start := time.Now()
+	diagnostics, err := store.Preload(workers, func(loaded int, total int) {
+		if loaded == total || loaded%100 == 0 {
+			log.Printf("Preloaded %d of %d assets", loaded, total)
+		}
+	})
+	if err != nil {
+		log.Printf("Preload failed: %v", err)
+		return
+	}
+	for _, diagnostic := range diagnostics {
+		log.Println(diagnostic)
+	}
+	log.Printf("Preloaded in %s with %d errors", time.Since(start), len(diagnostics))
+}
+
+// snapshot saves the project as a named snapshot
+func snapshot(store core.AssetStore, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: scritti snapshot NAME")
+	}
+	s, err := store.SaveSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved snapshot %q of %d assets\n", s.Name, len(s.Assets))
+	return nil
+}
+
+// diff prints the changes between two snapshots, or a snapshot and the working copy
+func diff(store core.AssetStore, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("Usage: scritti diff FROM [TO]")
+	}
+
+	from, err := store.LoadSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+
+	var to core.Snapshot
+	if len(args) == 2 {
+		to, err = store.LoadSnapshot(args[1])
+	} else {
+		to, err = store.TakeSnapshot()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, d := range core.Diff(from, to) {
+		fmt.Printf("%s %s\n", d.Status, d.ID.Name)
+		fmt.Print(d.Source)
+		fmt.Print(d.HTML)
+	}
+	return nil
+}
+
+// export writes the project as a bundle to a file, or stdout
+func export(store core.AssetStore, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Usage: scritti export [FILE]")
+	}
+	if len(args) == 0 || args[0] == "-" {
+		return core.ExportBundle(store, os.Stdout)
+	}
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := core.ExportBundle(store, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// load sets the assets of a bundle read from a file, or stdin
+func load(store core.AssetStore, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: scritti import FILE")
+	}
+	if args[0] == "-" {
+		return core.ImportBundle(store, os.Stdin)
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return core.ImportBundle(store, file)
 }
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	core "scritti/core"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// maxHistory bounds the operations kept per document for transforming late edits
+const maxHistory = 1000
+
+// EditData is an operation against a version of an asset's source
+type EditData struct {
+	ID        core.AssetKey  `json:"id"`
+	Version   int            `json:"version"`
+	Operation core.Operation `json:"operation"`
+}
+
+// DocumentData is the state of an asset's source at a version
+type DocumentData struct {
+	ID      core.AssetKey `json:"id"`
+	Version int           `json:"version"`
+	Source  string        `json:"source"`
+}
+
+// document is an asset being edited collaboratively. Operations from clients
+// are transformed against those applied since the version they were based on.
+// Stored is the store version of the asset the source was last synced with
+type document struct {
+	mu      sync.Mutex
+	key     core.AssetKey
+	version int
+	source  string
+	stored  string
+	history []core.Operation
+	clients map[*websocket.Conn]struct{}
+}
+
+// documents tracks the assets open for collaborative editing
+type documents struct {
+	mu      sync.Mutex
+	entries map[core.AssetKey]*document
+}
+
+// newDocuments returns a new documents instance
+func newDocuments() *documents {
+	return &documents{
+		entries: make(map[core.AssetKey]*document),
+	}
+}
+
+// get returns the open document for an asset, or nil
+func (d *documents) get(key core.AssetKey) *document {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.entries[key]
+}
+
+// open returns the document for an asset, loading its source and store
+// version with fn if not already open, and subscribes a client to its edits
+func (d *documents) open(key core.AssetKey, ws *websocket.Conn, fn func(core.AssetKey) (string, string, error)) (*document, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.entries[key]
+	if !ok {
+		source, stored, err := fn(key)
+		if err != nil {
+			return nil, err
+		}
+		doc = &document{
+			key:     key,
+			source:  source,
+			stored:  stored,
+			clients: make(map[*websocket.Conn]struct{}),
+		}
+		// Without a client to leave, edits apply to a transient document
+		if ws == nil {
+			return doc, nil
+		}
+		d.entries[key] = doc
+	}
+
+	if ws != nil {
+		doc.mu.Lock()
+		doc.clients[ws] = struct{}{}
+		doc.mu.Unlock()
+	}
+	return doc, nil
+}
+
+// leave unsubscribes a client from every document, closing documents no
+// longer edited by anyone so they are reloaded from the store when next opened
+func (d *documents) leave(ws *websocket.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, doc := range d.entries {
+		doc.mu.Lock()
+		delete(doc.clients, ws)
+		empty := len(doc.clients) == 0
+		doc.mu.Unlock()
+		if empty {
+			delete(d.entries, key)
+		}
+	}
+}
+
+// transform rebases an operation based on version onto the latest version,
+// returning it with the source it produces. The document is left unchanged
+func (doc *document) transform(version int, operation core.Operation) (core.Operation, string, error) {
+	if version > doc.version {
+		return nil, "", fmt.Errorf("Unknown version %d of %q", version, doc.key.Name)
+	}
+	missed := doc.version - version
+	if missed > len(doc.history) {
+		return nil, "", fmt.Errorf("Version %d of %q is too old, reopen the asset", version, doc.key.Name)
+	}
+
+	for _, concurrent := range doc.history[len(doc.history)-missed:] {
+		var err error
+		_, operation, err = core.Transform(concurrent, operation)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	source, err := operation.Apply(doc.source)
+	if err != nil {
+		return nil, "", err
+	}
+	return operation, source, nil
+}
+
+// commit records a transformed operation and the source it produced, once
+// saved to the store, and returns the new version
+func (doc *document) commit(operation core.Operation, source string) int {
+	doc.source = source
+	doc.stored = core.ContentVersion(source)
+	doc.version++
+	doc.history = append(doc.history, operation)
+	if len(doc.history) > maxHistory {
+		doc.history = doc.history[len(doc.history)-maxHistory:]
+	}
+	return doc.version
+}
+
+// broadcast returns an applied edit to send to every subscribed client except
+// the author. Must be called with the document locked
+func (doc *document) broadcast(author *websocket.Conn, edit EditData) outgoing {
+	o := outgoing{
+		notification: JsonRpcNotification{
+			JSONRPC: "2.0",
+			Method:  "edit",
+			Params:  edit,
+		},
+	}
+	for ws := range doc.clients {
+		if ws != author {
+			o.recipients = append(o.recipients, ws)
+		}
+	}
+	return o
+}
+
+// reset replaces the source of a document changed outside of collaborative
+// editing, sending the change to every client as an operation
+func (doc *document) reset(source string) error {
+	doc.mu.Lock()
+	replaced, err := doc.sync(source)
+	doc.mu.Unlock()
+
+	replaced.send()
+	return err
+}
+
+// sync replaces the source of a document with the store's, if different,
+// returning the replacement to send to clients. Must be called with the
+// document locked
+func (doc *document) sync(source string) (outgoing, error) {
+	if core.ContentVersion(source) == doc.stored {
+		return outgoing{}, nil
+	}
+
+	operation, source, err := doc.transform(doc.version, core.NewReplaceOperation(doc.source, source))
+	if err != nil {
+		return outgoing{}, err
+	}
+	version := doc.commit(operation, source)
+
+	return doc.broadcast(nil, EditData{
+		ID:        doc.key,
+		Version:   version,
+		Operation: operation,
+	}), nil
+}
+
+// source returns the source of an asset in the store and its version. The
+// source is read unrendered, so components that fail to render can be edited
+func (p ComponentServer) source(key core.AssetKey) (string, string, error) {
+	asset, version, err := p.store.GetVersion(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch v := asset.(type) {
+	case core.Component:
+		return v.Source, version, nil
+	case core.Style:
+		return v.Source, version, nil
+	case core.SVG:
+		return v.Source, version, nil
+	}
+	return "", "", fmt.Errorf("Can't edit %d %q", key.AssetType, key.Name)
+}
+
+// edit applies an operation to a document, saving the result to the store and
+// sending it to other clients editing the asset. The document only changes
+// once saved. Changes made to the asset outside of the document, such as disk
+// edits or imports, are merged in first rather than overwritten
+func (p ComponentServer) edit(doc *document, author *websocket.Conn, version int, operation core.Operation) (*DocumentData, error) {
+	name := p.hub.author(author)
+
+	doc.mu.Lock()
+	result, sent, err := p.save(doc, name, author, version, operation)
+	doc.mu.Unlock()
+
+	for _, o := range sent {
+		o.send()
+	}
+	return result, err
+}
+
+// save applies and saves an operation, returning the edits to send to
+// clients. Must be called with the document locked
+func (p ComponentServer) save(doc *document, name string, author *websocket.Conn, version int, operation core.Operation) (*DocumentData, []outgoing, error) {
+	sent := []outgoing{}
+	for attempt := 0; ; attempt++ {
+		transformed, source, err := doc.transform(version, operation)
+		if err != nil {
+			return nil, sent, err
+		}
+
+		err = p.store.SetIfVersionAs(doc.key, source, doc.stored, name)
+		conflict, ok := err.(*core.ConflictError)
+		if ok && attempt == 0 && len(conflict.Version) > 0 {
+			replaced, err := doc.sync(conflict.Content)
+			sent = append(sent, replaced)
+			if err != nil {
+				return nil, sent, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, sent, err
+		}
+
+		version := doc.commit(transformed, source)
+		sent = append(sent, doc.broadcast(author, EditData{
+			ID:        doc.key,
+			Version:   version,
+			Operation: transformed,
+		}))
+
+		return &DocumentData{
+			ID:      doc.key,
+			Version: version,
+			Source:  doc.source,
+		}, sent, nil
+	}
+}
+
+// openAction subscribes a client to edits of an asset, returning its current
+// source and version
+func (p ComponentServer) openAction(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
+	var key core.AssetKey
+	json.Unmarshal([]byte(request.Params), &key)
+	log.Printf("Open: %q\n", key)
+
+	doc, err := p.documents.open(key, ws, p.source)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	// A document already open may be behind changes made outside of it
+	source, _, err := p.source(key)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	doc.mu.Lock()
+	replaced, err := doc.sync(source)
+	data := &DocumentData{
+		ID:      key,
+		Version: doc.version,
+		Source:  doc.source,
+	}
+	doc.mu.Unlock()
+
+	replaced.send()
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  data,
+		ID:      request.ID,
+	}
+}
+
+// editAction applies a client operation to an asset
+func (p ComponentServer) editAction(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
+	var data EditData
+	if err := json.Unmarshal([]byte(request.Params), &data); err != nil {
+		return makeError(request.ID, err)
+	}
+	log.Printf("Edit: %q version %d\n", data.ID, data.Version)
+
+	doc, err := p.documents.open(data.ID, ws, p.source)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	result, err := p.edit(doc, ws, data.Version, data.Operation)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  result,
+		ID:      request.ID,
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	core "scritti/core"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/net/websocket"
+)
+
+// call sends a JSON RPC request, skipping notifications until the response
+func call(t *testing.T, ws *websocket.Conn, method string, params interface{}, result interface{}) *JsonRpcError {
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = websocket.JSON.Send(ws, JsonRpcRequest{JSONRPC: "2.0", Method: method, Params: data, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var response struct {
+			Result json.RawMessage `json:"result"`
+			Error  *JsonRpcError   `json:"error"`
+			ID     json.RawMessage `json:"id"`
+		}
+		if err := websocket.JSON.Receive(ws, &response); err != nil {
+			t.Fatal(err)
+		}
+		// Pushed AssetData and notifications don't carry the request id
+		if string(response.ID) != "1" {
+			continue
+		}
+		if response.Error == nil && result != nil {
+			json.Unmarshal(response.Result, result)
+		}
+		return response.Error
+	}
+}
+
+func TestCollaborativeEditing(t *testing.T) {
+	server, _ := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleHotReload))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	dial := func() *websocket.Conn {
+		ws, err := websocket.Dial(url, "", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ws
+	}
+	alice, bob := dial(), dial()
+	defer alice.Close()
+	defer bob.Close()
+
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+
+	var opened DocumentData
+	if err := call(t, alice, "open", key, &opened); err != nil {
+		t.Fatal(err.Message)
+	}
+	if err := call(t, bob, "open", key, nil); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	// Both edit the same version concurrently
+	var aliceResult, bobResult DocumentData
+	edit := EditData{ID: key, Version: opened.Version, Operation: core.NewReplaceOperation(opened.Source, "class0\n"+opened.Source)}
+	if err := call(t, alice, "edit", edit, &aliceResult); err != nil {
+		t.Fatal(err.Message)
+	}
+	edit = EditData{ID: key, Version: opened.Version, Operation: core.NewReplaceOperation(opened.Source, opened.Source+"\nclass3")}
+	if err := call(t, bob, "edit", edit, &bobResult); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	want := "class0\nclass1\nclass2\nclass3"
+	if bobResult.Source != want || bobResult.Version != 2 {
+		t.Errorf("Got %q at version %d, want %q at version 2", bobResult.Source, bobResult.Version, want)
+	}
+
+	// Alice should receive Bob's transformed operation
+	for {
+		var notification struct {
+			Method string   `json:"method"`
+			Params EditData `json:"params"`
+		}
+		if err := websocket.JSON.Receive(alice, &notification); err != nil {
+			t.Fatal(err)
+		}
+		if notification.Method != "edit" {
+			continue
+		}
+		got, err := notification.Params.Operation.Apply(aliceResult.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Got %q, want %q", got, want)
+		}
+		break
+	}
+
+	// The merged source is saved to the store
+	asset, err := server.store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := asset.(core.Style).Source; got != want {
+		t.Errorf("Got stored %q, want %q", got, want)
+	}
+}
+
+func TestEditStaleVersion(t *testing.T) {
+	server, _ := newTestServer(t)
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+	doc := &document{key: key, source: "abc", version: 5}
+
+	if _, err := server.edit(doc, nil, 2, core.Operation{{Retain: 3}}); err == nil {
+		t.Error("Expected error for version older than history")
+	}
+	if _, err := server.edit(doc, nil, 6, core.Operation{{Retain: 3}}); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+}
+
+func TestVersionedSetWithOpenDocument(t *testing.T) {
+	server, _ := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleHotReload))
+	defer ts.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+	var opened DocumentData
+	if err := call(t, ws, "open", key, &opened); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	// The version is checked even though the asset is open for editing
+	if err := call(t, ws, "set", AssetData{ID: key, Source: "class9", Version: "deadbeef"}, nil); err == nil {
+		t.Error("Expected conflict for a stale version")
+	}
+
+	data := AssetData{ID: key, Source: "class9", Version: core.ContentVersion(opened.Source)}
+	if err := call(t, ws, "set", data, nil); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	history, err := server.store.History(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := history.Revisions[len(history.Revisions)-1]
+	if latest.Content != "class9" || latest.Author == "" {
+		t.Errorf("Got %+v, want class9 with an author", latest)
+	}
+
+	// The open document follows the set
+	var reopened DocumentData
+	if err := call(t, ws, "open", key, &reopened); err != nil {
+		t.Fatal(err.Message)
+	}
+	if reopened.Source != "class9" {
+		t.Errorf("Got %q, want %q", reopened.Source, "class9")
+	}
+}
+
+func TestEditExternalChange(t *testing.T) {
+	server, fs := newTestServer(t)
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+
+	t.Run("Test change on disk", func(t *testing.T) {
+		doc, err := server.documents.open(key, nil, server.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsWrite(fs, "style/root", "class7\nclass8")
+
+		// Append to the source the document was opened with
+		result, err := server.edit(doc, nil, 0, core.Operation{{Retain: len("class1\nclass2")}, {Insert: "X"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "class7\nclass8X"
+		if result.Source != want {
+			t.Errorf("Got %q, want %q", result.Source, want)
+		}
+		source, _, err := server.source(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source != want {
+			t.Errorf("Got stored %q, want %q", source, want)
+		}
+	})
+
+	t.Run("Test failed write", func(t *testing.T) {
+		files := fstest.MapFS{"style/root": &fstest.MapFile{Data: []byte("class1")}}
+		store := core.NewFileStore(filesystem.NewFSFileSystem(files, 0), "")
+		defer store.Close()
+		server := NewComponentServer(store)
+
+		doc, err := server.documents.open(key, nil, server.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.edit(doc, nil, 0, core.Operation{{Retain: 6}, {Insert: "X"}}); err == nil {
+			t.Fatal("Expected write error")
+		}
+
+		// The document is not ahead of the store
+		if doc.version != 0 || doc.source != "class1" {
+			t.Errorf("Got %q at version %d, want %q at version 0", doc.source, doc.version, "class1")
+		}
+	})
+
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	core "scritti/core"
+	"strconv"
+	"strings"
+)
+
+// eventKey returns the AssetKey requested by the asset and type query parameters,
+// defaulting to the main Component
+func eventKey(r *http.Request) (core.AssetKey, error) {
+	key := core.AssetKey{AssetType: core.ComponentType, Name: "main"}
+	query := r.URL.Query()
+
+	if name := query.Get("asset"); len(name) > 0 {
+		key.Name = name
+	}
+
+	if assetType := query.Get("type"); len(assetType) > 0 {
+		n, err := strconv.Atoi(assetType)
+		if err != nil {
+			return key, fmt.Errorf("Invalid asset type %q", assetType)
+		}
+		key.AssetType = core.AssetType(n)
+	}
+
+	return key, nil
+}
+
+// writeEvent writes a JSON encoded Server-Sent Event, of the default message
+// type if event is empty
+func writeEvent(w io.Writer, event string, v interface{}) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(event) > 0 {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", message)
+	return err
+}
+
+// HandleEvents streams asset change notifications as Server-Sent Events, for
+// clients unable to establish a WebSocket connection
+func (p ComponentServer) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	key, err := eventKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !p.connections.add() {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.connections.done()
+
+	done := make(chan bool)
+	defer close(done)
+
+	// Subscribe before responding so no change is missed
+	watch, err := p.store.Watch(key, done)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(*core.AssetNotFound); ok {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Println("Event stream opened by " + r.RemoteAddr)
+
+	for {
+		select {
+		case <-p.connections.closing:
+			return
+		case <-r.Context().Done():
+			log.Println("Event stream closed by " + r.RemoteAddr)
+			return
+		case _, ok := <-watch:
+			if !ok {
+				return
+			}
+			var err error
+			data, renderErr := p.renderAsset(key)
+			if renderErr != nil {
+				log.Printf("Unable to render %q, %v\n", key.Name, renderErr)
+				err = writeEvent(w, "asset-error", makeErrorNotification(key, renderErr))
+			} else {
+				err = writeEvent(w, "", data)
+			}
+			if err != nil {
+				log.Println("message not sent " + err.Error())
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// HandleRPC serves JSON RPC requests sent as plain HTTP POST requests
+func (p ComponentServer) HandleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request JsonRpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Conditional sets may give the expected version as an If-Match header
+	if match := r.Header.Get("If-Match"); len(match) > 0 && request.Method == "set" {
+		var data AssetData
+		if err := json.Unmarshal(request.Params, &data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, err := p.matchVersion(data.ID, strings.Trim(strings.TrimPrefix(match, "W/"), `"`))
+		if err != nil {
+			writeResponse(w, makeError(request.ID, err))
+			return
+		}
+		data.Version = version
+		request.Params, _ = json.Marshal(data)
+	}
+
+	writeResponse(w, p.dispatch(request, nil))
+}
+
+// matchVersion returns the version an If-Match value requires. The wildcard
+// matches the current version of an asset, if it exists
+func (p ComponentServer) matchVersion(key core.AssetKey, match string) (string, error) {
+	if match != "*" {
+		return match, nil
+	}
+	_, version, err := p.store.GetVersion(key)
+	if _, ok := err.(*core.AssetNotFound); ok {
+		return "", &core.ConflictError{Key: key}
+	}
+	return version, err
+}
+
+// writeResponse writes a JSON RPC response to an HTTP request, with the
+// version of any asset returned as its ETag
+func writeResponse(w http.ResponseWriter, response JsonRpcResponse) {
+	if data, ok := response.Result.(*AssetData); ok && len(data.Version) > 0 {
+		w.Header().Set("ETag", `"`+data.Version+`"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Error != nil && response.Error.Code == 2 {
+		w.WriteHeader(http.StatusPreconditionFailed)
+	}
+	if err := json.NewEncoder(w).Encode(&response); err != nil {
+		log.Println("Message not sent " + err.Error())
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	core "scritti/core"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*ComponentServer, filesystem.FileSystem) {
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "main", "root")
+	fsWrite(fs, "style/root", "class1\nclass2")
+	store := core.NewFileStore(fs, "")
+	t.Cleanup(func() { store.Close() })
+	return NewComponentServer(store), fs
+}
+
+func TestHandleRPC(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	t.Run("Test get over HTTP POST", func(t *testing.T) {
+		body := `{"jsonrpc":"2.0","method":"get","params":{"assetType":0,"name":"main"},"id":1}`
+		r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.HandleRPC(w, r)
+
+		var response struct {
+			Result AssetData     `json:"result"`
+			Error  *JsonRpcError `json:"error"`
+			ID     int           `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Error != nil {
+			t.Fatalf("Unexpected error %q", response.Error.Message)
+		}
+
+		want := `<div class="class1 class2"></div>`
+		if response.Result.HTML != want {
+			t.Errorf("Got %q, want %q", response.Result.HTML, want)
+		}
+		if response.ID != 1 {
+			t.Errorf("Got id %d, want 1", response.ID)
+		}
+	})
+
+	t.Run("Test set with If-Match", func(t *testing.T) {
+		set := func(version string) *httptest.ResponseRecorder {
+			body := `{"jsonrpc":"2.0","method":"set","params":{"id":{"assetType":1,"name":"root"},"source":"class3"},"id":1}`
+			r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+			r.Header.Set("If-Match", `"`+version+`"`)
+			w := httptest.NewRecorder()
+			server.HandleRPC(w, r)
+			return w
+		}
+
+		stale := set(core.ContentVersion("stale"))
+		if stale.Code != http.StatusPreconditionFailed {
+			t.Errorf("Got status %d, want %d", stale.Code, http.StatusPreconditionFailed)
+		}
+
+		w := set(core.ContentVersion("class1\nclass2"))
+		if w.Code != http.StatusOK {
+			t.Errorf("Got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if got, want := w.Header().Get("ETag"), `"`+core.ContentVersion("class3")+`"`; got != want {
+			t.Errorf("Got ETag %s, want %s", got, want)
+		}
+	})
+
+	t.Run("Test set with If-Match wildcard", func(t *testing.T) {
+		set := func(name string) *httptest.ResponseRecorder {
+			body := `{"jsonrpc":"2.0","method":"set","params":{"id":{"assetType":1,"name":"` + name + `"},"source":"class4"},"id":1}`
+			r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+			r.Header.Set("If-Match", "*")
+			w := httptest.NewRecorder()
+			server.HandleRPC(w, r)
+			return w
+		}
+
+		if w := set("root"); w.Code != http.StatusOK {
+			t.Errorf("Got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if w := set("missing"); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("Got status %d, want %d", w.Code, http.StatusPreconditionFailed)
+		}
+	})
+
+	t.Run("Test metrics", func(t *testing.T) {
+		body := `{"jsonrpc":"2.0","method":"metrics","id":1}`
+		r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.HandleRPC(w, r)
+
+		var response struct {
+			Result core.StoreMetrics `json:"result"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Result.Entries == 0 || response.Result.Capacity != 0 {
+			t.Errorf("Got %+v, want the entries of an unlimited store", response.Result)
+		}
+	})
+
+	t.Run("Test reject GET", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/rpc", nil)
+		w := httptest.NewRecorder()
+		server.HandleRPC(w, r)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestHandleEvents(t *testing.T) {
+	server, fs := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleEvents))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "?asset=main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Got content type %q, want text/event-stream", got)
+	}
+
+	fsWrite(fs, "main", "root\n\troot")
+
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data AssetData
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<div class="class1 class2"><div class="class1 class2"></div></div>`
+	if data.HTML != want {
+		t.Errorf("Got %q, want %q", data.HTML, want)
+	}
+}
+
+func TestHandleHotReload(t *testing.T) {
+	server, _ := newTestServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	w := httptest.NewRecorder()
+	server.HandleHotReload(w, r)
+
+	if w.Code != http.StatusUpgradeRequired {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusUpgradeRequired)
+	}
+}
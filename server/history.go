@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	core "scritti/core"
+
+	"golang.org/x/net/websocket"
+)
+
+// RevertData identifies a revision of an asset
+type RevertData struct {
+	ID       core.AssetKey `json:"id"`
+	Revision int           `json:"revision"`
+}
+
+// restored updates any collaborative document of an asset restored to an
+// earlier revision
+func (p ComponentServer) restored(key core.AssetKey, revision core.Revision) {
+	if doc := p.documents.get(key); doc != nil {
+		if err := doc.reset(revision.Content); err != nil {
+			log.Printf("Unable to reset document %q, %v\n", key.Name, err)
+		}
+	}
+}
+
+// historyAction returns the revision log of an asset
+func (p ComponentServer) historyAction(request JsonRpcRequest) JsonRpcResponse {
+	var key core.AssetKey
+	json.Unmarshal([]byte(request.Params), &key)
+	log.Printf("History: %q\n", key)
+
+	history, err := p.store.History(key)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  history,
+		ID:      request.ID,
+	}
+}
+
+// undoAction steps an asset backwards or forwards through its history with fn,
+// recorded under the socket's author, returning the restored revision
+func (p ComponentServer) undoAction(request JsonRpcRequest, ws *websocket.Conn, fn func(core.AssetKey, string) (core.Revision, error)) JsonRpcResponse {
+	var key core.AssetKey
+	json.Unmarshal([]byte(request.Params), &key)
+	log.Printf("%s: %q\n", request.Method, key)
+
+	revision, err := fn(key, p.hub.author(ws))
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+	p.restored(key, revision)
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  revision,
+		ID:      request.ID,
+	}
+}
+
+// revertAction restores an asset to a revision, recorded under the socket's author
+func (p ComponentServer) revertAction(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
+	var data RevertData
+	if err := json.Unmarshal([]byte(request.Params), &data); err != nil {
+		return makeError(request.ID, err)
+	}
+	log.Printf("Revert: %q to %d\n", data.ID, data.Revision)
+
+	if err := p.store.RevertAs(data.ID, data.Revision, p.hub.author(ws)); err != nil {
+		return makeError(request.ID, err)
+	}
+
+	history, err := p.store.History(data.ID)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+	for _, revision := range history.Revisions {
+		if revision.ID == data.Revision {
+			p.restored(data.ID, revision)
+		}
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  history,
+		ID:      request.ID,
+	}
+}
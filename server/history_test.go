@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	core "scritti/core"
+	"testing"
+)
+
+func TestUndoAction(t *testing.T) {
+	server, _ := newTestServer(t)
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+	params, _ := json.Marshal(key)
+
+	server.store.SetAs(key, "class3", "client-1")
+
+	response := server.dispatch(JsonRpcRequest{JSONRPC: "2.0", Method: "undo", Params: params, ID: 1}, nil)
+	if response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	if revision := response.Result.(core.Revision); revision.Content != "class1\nclass2" {
+		t.Errorf("Got %q, want the original content", revision.Content)
+	}
+
+	response = server.dispatch(JsonRpcRequest{JSONRPC: "2.0", Method: "history", Params: params, ID: 2}, nil)
+	if response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	history := response.Result.(core.AssetHistory)
+	if len(history.Revisions) != 2 || history.Current != history.Revisions[0].ID {
+		t.Errorf("Got %+v, want 2 revisions with the first current", history)
+	}
+
+	ws := stalledConn(t)
+	server.hub.join(ws)
+	response = server.dispatch(JsonRpcRequest{JSONRPC: "2.0", Method: "redo", Params: params, ID: 3}, ws)
+	if response.Error != nil {
+		t.Fatal(response.Error.Message)
+	}
+	history, _ = server.store.History(key)
+	if history.RestoredBy != server.hub.author(ws) {
+		t.Errorf("Got %q, want %q", history.RestoredBy, server.hub.author(ws))
+	}
+
+	server.dispatch(JsonRpcRequest{JSONRPC: "2.0", Method: "undo", Params: params, ID: 4}, nil)
+	response = server.dispatch(JsonRpcRequest{JSONRPC: "2.0", Method: "undo", Params: params, ID: 5}, nil)
+	if response.Error == nil {
+		t.Error("Expected error undoing past the first revision")
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	core "scritti/core"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// Selection is a cursor or selected range within an asset's source, in runes
+type Selection struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// PresenceData describes the asset a client has open and where its cursor is.
+// ID is nil once the client has closed the asset or disconnected
+type PresenceData struct {
+	Client    int            `json:"client"`
+	ID        *core.AssetKey `json:"id"`
+	Selection *Selection     `json:"selection,omitempty"`
+}
+
+// session is a client connected to the server
+type session struct {
+	id        int
+	ws        *websocket.Conn
+	asset     *core.AssetKey
+	selection *Selection
+}
+
+// presence returns the PresenceData of a session
+func (s *session) presence() PresenceData {
+	return PresenceData{
+		Client:    s.id,
+		ID:        s.asset,
+		Selection: s.selection,
+	}
+}
+
+// outgoing is a notification to send once locks are released, so a slow
+// client never holds up the others
+type outgoing struct {
+	recipients   []*websocket.Conn
+	notification JsonRpcNotification
+}
+
+// send delivers the notification to every recipient
+func (o outgoing) send() {
+	for _, ws := range o.recipients {
+		if err := websocket.JSON.Send(ws, o.notification); err != nil {
+			log.Println("message not sent " + err.Error())
+		}
+	}
+}
+
+// hub is a registry of the sessions connected to a project
+type hub struct {
+	mu       sync.Mutex
+	next     int
+	sessions map[*websocket.Conn]*session
+}
+
+// newHub returns a new hub instance
+func newHub() *hub {
+	return &hub{
+		sessions: make(map[*websocket.Conn]*session),
+	}
+}
+
+// join registers a socket, returning its session
+func (h *hub) join(ws *websocket.Conn) *session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	s := &session{
+		id: h.next,
+		ws: ws,
+	}
+	h.sessions[ws] = s
+	return s
+}
+
+// leave unregisters a socket, telling clients on the same asset it has gone
+func (h *hub) leave(ws *websocket.Conn) {
+	h.mu.Lock()
+	s, ok := h.sessions[ws]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.sessions, ws)
+
+	var gone outgoing
+	if s.asset != nil {
+		gone = h.broadcast(*s.asset, s, PresenceData{Client: s.id})
+	}
+	h.mu.Unlock()
+
+	gone.send()
+}
+
+// author returns the name a socket's changes are recorded under in asset
+// history, empty for plain HTTP requests
+func (h *hub) author(ws *websocket.Conn) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[ws]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("client-%d", s.id)
+}
+
+// update sets the asset and selection of a socket's session, notifying clients
+// on both the previous and new asset, and returns the presence of the other
+// clients on the new asset
+func (h *hub) update(ws *websocket.Conn, key *core.AssetKey, selection *Selection) []PresenceData {
+	h.mu.Lock()
+	s, ok := h.sessions[ws]
+	if !ok {
+		h.mu.Unlock()
+		return nil
+	}
+
+	previous := s.asset
+	s.asset, s.selection = key, selection
+
+	var left, joined outgoing
+	if previous != nil && (key == nil || *previous != *key) {
+		left = h.broadcast(*previous, s, PresenceData{Client: s.id})
+	}
+
+	others := []PresenceData{}
+	if key != nil {
+		joined = h.broadcast(*key, s, s.presence())
+		for _, other := range h.sessions {
+			if other != s && other.asset != nil && *other.asset == *key {
+				others = append(others, other.presence())
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	left.send()
+	joined.send()
+	return others
+}
+
+// broadcast returns presence to send to every session on an asset except the
+// sender. Must be called with the hub locked
+func (h *hub) broadcast(key core.AssetKey, sender *session, presence PresenceData) outgoing {
+	o := outgoing{
+		notification: JsonRpcNotification{
+			JSONRPC: "2.0",
+			Method:  "presence",
+			Params:  presence,
+		},
+	}
+	for _, s := range h.sessions {
+		if s == sender || s.asset == nil || *s.asset != key {
+			continue
+		}
+		o.recipients = append(o.recipients, s.ws)
+	}
+	return o
+}
+
+// presenceAction updates the asset and selection of the calling client,
+// returning the presence of other clients on the asset
+func (p ComponentServer) presenceAction(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
+	if ws == nil {
+		return makeError(request.ID, errors.New("Presence requires a WebSocket connection"))
+	}
+
+	var data PresenceData
+	if err := json.Unmarshal([]byte(request.Params), &data); err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  p.hub.update(ws, data.ID, data.Selection),
+		ID:      request.ID,
+	}
+}
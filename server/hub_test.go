@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	core "scritti/core"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// receivePresence returns the next presence notification, skipping other messages
+func receivePresence(t *testing.T, ws *websocket.Conn) PresenceData {
+	for {
+		var notification struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := websocket.JSON.Receive(ws, &notification); err != nil {
+			t.Fatal(err)
+		}
+		if notification.Method != "presence" {
+			continue
+		}
+		var presence PresenceData
+		if err := json.Unmarshal(notification.Params, &presence); err != nil {
+			t.Fatal(err)
+		}
+		return presence
+	}
+}
+
+func TestPresence(t *testing.T) {
+	server, _ := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleHotReload))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	dial := func() *websocket.Conn {
+		ws, err := websocket.Dial(url, "", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ws
+	}
+	alice, bob := dial(), dial()
+	defer alice.Close()
+
+	key := core.AssetKey{AssetType: core.ComponentType, Name: "main"}
+
+	var others []PresenceData
+	if err := call(t, alice, "presence", PresenceData{ID: &key, Selection: &Selection{1, 1}}, &others); err != nil {
+		t.Fatal(err.Message)
+	}
+	if len(others) != 0 {
+		t.Errorf("Got %d other clients, want 0", len(others))
+	}
+
+	if err := call(t, bob, "presence", PresenceData{ID: &key, Selection: &Selection{2, 4}}, &others); err != nil {
+		t.Fatal(err.Message)
+	}
+	if len(others) != 1 || others[0].Selection.Head != 1 {
+		t.Errorf("Got %+v, want alice's presence", others)
+	}
+
+	t.Run("Test presence broadcast", func(t *testing.T) {
+		presence := receivePresence(t, alice)
+		if presence.ID == nil || *presence.ID != key || presence.Selection.Head != 4 {
+			t.Errorf("Got %+v, want bob's selection on main", presence)
+		}
+	})
+
+	t.Run("Test disconnect broadcast", func(t *testing.T) {
+		bob.Close()
+		presence := receivePresence(t, alice)
+		if presence.ID != nil {
+			t.Errorf("Got %+v, want bob to have left", presence)
+		}
+	})
+}
+
+// stalledConn returns a WebSocket client whose peer completes the handshake
+// and then never reads, so every send blocks
+func stalledConn(t *testing.T) *websocket.Conn {
+	client, peer := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		peer.Close()
+	})
+
+	go func() {
+		request, err := http.ReadRequest(bufio.NewReader(peer))
+		if err != nil {
+			return
+		}
+		hash := sha1.Sum([]byte(request.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		fmt.Fprintf(peer, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			base64.StdEncoding.EncodeToString(hash[:]))
+	}()
+
+	config, err := websocket.NewConfig("ws://stalled/", "http://stalled/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := websocket.NewClient(config, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestStalledClient(t *testing.T) {
+	server, _ := newTestServer(t)
+	key := core.AssetKey{AssetType: core.StyleType, Name: "root"}
+
+	// within fails if fn doesn't return promptly
+	within := func(t *testing.T, name string, fn func()) {
+		finished := make(chan bool)
+		go func() {
+			fn()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s blocked by a stalled client", name)
+		}
+	}
+
+	t.Run("Test presence", func(t *testing.T) {
+		stalled, sender := stalledConn(t), stalledConn(t)
+		server.hub.join(stalled)
+		server.hub.join(sender)
+		within(t, "Update", func() { server.hub.update(stalled, &key, nil) })
+
+		// Notifying the stalled client blocks the sender only
+		go server.hub.update(sender, &key, nil)
+		time.Sleep(50 * time.Millisecond)
+		within(t, "Author", func() { server.hub.author(sender) })
+	})
+
+	t.Run("Test edits", func(t *testing.T) {
+		stalled, other := stalledConn(t), stalledConn(t)
+		doc, err := server.documents.open(key, stalled, server.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Sending the edit to the stalled client blocks the editor only
+		go server.edit(doc, nil, 0, core.Operation{{Retain: len("class1\nclass2")}, {Insert: "X"}})
+		time.Sleep(50 * time.Millisecond)
+		within(t, "Open", func() { server.documents.open(key, other, server.source) })
+	})
+}
@@ -21,3 +21,9 @@ type JsonRpcError struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 }
+
+type JsonRpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// LiveReloadPort is the default port LiveReload browser extensions connect to
+const LiveReloadPort = 35729
+
+const liveReloadProtocol = "http://livereload.com/protocols/official-7"
+
+// liveReloadCommand is a message of the LiveReload protocol
+type liveReloadCommand struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS,omitempty"`
+	Message    string   `json:"message,omitempty"`
+}
+
+// liveReloadHandshake waits for the client hello and replies if the official
+// protocol is supported
+func liveReloadHandshake(ws *websocket.Conn) bool {
+	var hello liveReloadCommand
+	if err := websocket.JSON.Receive(ws, &hello); err != nil {
+		log.Println("LiveReload handshake not received " + err.Error())
+		return false
+	}
+
+	supported := false
+	for _, protocol := range hello.Protocols {
+		if protocol == liveReloadProtocol {
+			supported = true
+		}
+	}
+	if hello.Command != "hello" || !supported {
+		log.Printf("LiveReload handshake rejected %+v\n", hello)
+		return false
+	}
+
+	err := websocket.JSON.Send(ws, liveReloadCommand{
+		Command:    "hello",
+		Protocols:  []string{liveReloadProtocol},
+		ServerName: "scritti",
+	})
+	if err != nil {
+		log.Println("LiveReload handshake not sent " + err.Error())
+		return false
+	}
+	return true
+}
+
+// HandleLiveReload serves a LiveReload compatible WebSocket, sending a reload
+// command whenever the watched asset or any of its dependencies change
+func (p ComponentServer) HandleLiveReload(w http.ResponseWriter, r *http.Request) {
+	key, err := eventKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handler := func(ws *websocket.Conn) {
+		if !p.connections.add() {
+			return
+		}
+		defer p.connections.done()
+
+		done := make(chan bool)
+		defer close(done)
+
+		// Subscribe before the handshake completes so no change is missed
+		watch, err := p.store.Watch(key, done)
+
+		if !liveReloadHandshake(ws) {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Unable to watch %q, %v\n", key.Name, err)
+			alert := liveReloadCommand{
+				Command: "alert",
+				Message: err.Error(),
+			}
+			if err := websocket.JSON.Send(ws, alert); err != nil {
+				log.Println("message not sent " + err.Error())
+			}
+			return
+		}
+		log.Println("LiveReload connection established by " + ws.Request().RemoteAddr)
+
+		// Consume client messages (info, url) until the connection closes
+		closed := make(chan bool)
+		go func() {
+			defer close(closed)
+			for {
+				var command liveReloadCommand
+				if err := websocket.JSON.Receive(ws, &command); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-p.connections.closing:
+				ws.Close()
+				<-closed
+				return
+			case <-closed:
+				log.Println("LiveReload connection closed by " + ws.Request().RemoteAddr)
+				return
+			case _, ok := <-watch:
+				if !ok {
+					return
+				}
+				err := websocket.JSON.Send(ws, liveReloadCommand{
+					Command: "reload",
+					Path:    key.Name,
+					LiveCSS: true,
+				})
+				if err != nil {
+					log.Println("message not sent " + err.Error())
+					return
+				}
+			}
+		}
+	}
+
+	// LiveReload clients are browser extensions and command line tools, accept any origin
+	server := websocket.Server{
+		Handler:   handler,
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+	}
+	server.ServeHTTP(w, r)
+}
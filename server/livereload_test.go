@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestHandleLiveReload(t *testing.T) {
+	server, fs := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleLiveReload))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/livereload"
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	t.Run("Test hello handshake", func(t *testing.T) {
+		err := websocket.JSON.Send(ws, liveReloadCommand{
+			Command:   "hello",
+			Protocols: []string{liveReloadProtocol},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var hello liveReloadCommand
+		if err := websocket.JSON.Receive(ws, &hello); err != nil {
+			t.Fatal(err)
+		}
+		if hello.Command != "hello" {
+			t.Errorf("Got command %q, want hello", hello.Command)
+		}
+	})
+
+	t.Run("Test reload on dependency change", func(t *testing.T) {
+		fsWrite(fs, "style/root", "class3")
+
+		var reload liveReloadCommand
+		if err := websocket.JSON.Receive(ws, &reload); err != nil {
+			t.Fatal(err)
+		}
+		if reload.Command != "reload" || reload.Path != "main" {
+			t.Errorf("Got %+v, want reload of main", reload)
+		}
+	})
+}
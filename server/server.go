@@ -1,64 +1,82 @@
 package server
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	core "scritti/core"
-	"scritti/filesystem"
-	"strings"
+	"scritti/www"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long open connections are given to drain on shutdown
+const shutdownTimeout = 10 * time.Second
+
 type ComponentServer struct {
-	store core.AssetStore
+	store       core.AssetStore
+	connections *connectionTracker
+	documents   *documents
+	hub         *hub
+	assets      fs.FS
 }
 
-// NewComponentServer initializes a new server with a specified Asset Store
+// NewComponentServer initializes a new server with a specified Asset Store,
+// serving the web assets embedded in the binary
 func NewComponentServer(store core.AssetStore) *ComponentServer {
 	return &ComponentServer{
 		store,
+		newConnectionTracker(),
+		newDocuments(),
+		newHub(),
+		www.Files,
 	}
 }
 
-func getTemplate() string {
-	file, err := os.Open("www/index.html")
+// getTemplate returns the page template from the web assets
+func (p ComponentServer) getTemplate() (*template.Template, error) {
+	data, err := fs.ReadFile(p.assets, "index.html")
 	if err != nil {
-		panic("Unable to open template")
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+		return nil, err
 	}
-	return strings.Join(lines, "\n")
+	return template.New("main").Parse(string(data))
 }
 
-// ServeHTTP test
+// ServeHTTP renders the IDE page
 func (p ComponentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	base := getTemplate()
+	tmpl, err := p.getTemplate()
+	if err != nil {
+		log.Printf("Unable to load template: %v", err)
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
 	data := map[string]interface{}{}
-	tmpl := template.Must(template.New("main").Parse(base))
 	tmpl.Execute(w, data)
 }
 
-// Server initiates a web server on the given port
-func Server(port int) {
+// Server initiates a web server for an Asset Store on the given port,
+// running until interrupted. Web assets are served from the binary unless an
+// override, such as a www directory during development, is given
+func Server(port int, store core.AssetStore, assets fs.FS) {
 	mux := http.NewServeMux()
 
-	fs := filesystem.NewOSFileSystem()
-	store := core.NewFileStore(fs, "sampledata")
-	defer store.Close()
-
 	server := NewComponentServer(store)
+	if assets != nil {
+		server.assets = assets
+	}
 
-	mux.Handle("/wasm/", http.StripPrefix("/wasm/", http.FileServer(http.Dir("./www"))))
-	mux.Handle("/js/", http.StripPrefix("", http.FileServer(http.Dir("./www"))))
+	files := http.FileServer(http.FS(server.assets))
+	mux.Handle("/wasm/", http.StripPrefix("/wasm/", files))
+	mux.Handle("/js/", files)
 	mux.HandleFunc("/ws", server.HandleHotReload)
+	mux.HandleFunc("/events", server.HandleEvents)
+	mux.HandleFunc("/rpc", server.HandleRPC)
+	mux.HandleFunc("/livereload", server.HandleLiveReload)
 	mux.HandleFunc("/", server.ServeHTTP)
 
 	s := &http.Server{
@@ -66,8 +84,51 @@ func Server(port int) {
 		Handler: mux,
 	}
 
-	log.Printf("Starting sort on port %d", port)
-	if err := s.ListenAndServe(); err != nil {
-		log.Fatalf("Could not start server: %v", err)
+	// LiveReload browser extensions expect the protocol on a well known port
+	reloadMux := http.NewServeMux()
+	reloadMux.HandleFunc("/livereload", server.HandleLiveReload)
+	reload := &http.Server{
+		Addr:    fmt.Sprintf(":%d", LiveReloadPort),
+		Handler: reloadMux,
+	}
+
+	go func() {
+		log.Printf("Starting LiveReload on port %d", LiveReloadPort)
+		if err := reload.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Could not start LiveReload server: %v", err)
+		}
+	}()
+
+	stopped := make(chan error, 1)
+	go func() {
+		log.Printf("Starting sort on port %d", port)
+		stopped <- s.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-stopped:
+		log.Printf("Could not start server: %v", err)
+		return
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Drain sockets and event streams first, http.Server.Shutdown does not track
+	// hijacked connections
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Connections not drained: %v", err)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("Server not shut down: %v", err)
+	}
+	if err := reload.Shutdown(ctx); err != nil {
+		log.Printf("LiveReload server not shut down: %v", err)
 	}
 }
@@ -1 +1,58 @@
 package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func fsWrite(fs filesystem.FileSystem, name string, content string) {
+	file, err := fs.Create(name)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	w.WriteString(content)
+	w.Flush()
+}
+
+func TestServeHTTP(t *testing.T) {
+	t.Run("Test embedded template", func(t *testing.T) {
+		server, _ := newTestServer(t)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<x-ide>") {
+			t.Errorf("Got %d %q, want the IDE page", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Test assets override", func(t *testing.T) {
+		server, _ := newTestServer(t)
+		server.assets = fstest.MapFS{
+			"index.html": {Data: []byte("<title>dev</title>")},
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if got := w.Body.String(); got != "<title>dev</title>" {
+			t.Errorf("Got %q, want the override template", got)
+		}
+	})
+
+	t.Run("Test missing template", func(t *testing.T) {
+		server, _ := newTestServer(t)
+		server.assets = fstest.MapFS{}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Got %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
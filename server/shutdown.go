@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// connectionTracker counts open connections so shutdown can wait for them to drain
+type connectionTracker struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closing chan bool
+	closed  bool
+}
+
+// newConnectionTracker returns a new connectionTracker instance
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{
+		closing: make(chan bool),
+	}
+}
+
+// add registers a new connection, returning false if the server is shutting down
+func (c *connectionTracker) add() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.wg.Add(1)
+	return true
+}
+
+// done unregisters a connection
+func (c *connectionTracker) done() {
+	c.wg.Done()
+}
+
+// close signals all connections to finish and waits until they have, or the
+// context expires
+func (c *connectionTracker) close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+	c.mu.Unlock()
+
+	drained := make(chan bool)
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops accepting new connections, lets in-flight RPC calls complete
+// and closes all open WebSocket and event stream connections
+func (p ComponentServer) Shutdown(ctx context.Context) error {
+	return p.connections.close(ctx)
+}
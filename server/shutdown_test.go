@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	core "scritti/core"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestShutdown(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	fs := filesystem.NewMemoryFileSystem()
+	fsWrite(fs, "main", "root")
+	fsWrite(fs, "style/root", "class1\nclass2")
+	store := core.NewFileStore(fs, "")
+	server := NewComponentServer(store)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", server.HandleHotReload)
+	mux.HandleFunc("/events", server.HandleEvents)
+	ts := httptest.NewServer(mux)
+
+	// Open a WebSocket and complete an rpc call
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = websocket.JSON.Send(ws, JsonRpcRequest{
+		JSONRPC: "2.0",
+		Method:  "get",
+		Params:  []byte(`{"assetType":0,"name":"main"}`),
+		ID:      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response JsonRpcResponse
+	if err := websocket.JSON.Receive(ws, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open an event stream
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Connections not drained: %v", err)
+	}
+
+	// The server should have closed the socket
+	if err := websocket.JSON.Receive(ws, &response); err == nil {
+		t.Error("Expected socket to be closed")
+	}
+	ws.Close()
+
+	// The server should have ended the event stream
+	if _, err := bufio.NewReader(res.Body).ReadString('\n'); err == nil {
+		t.Error("Expected event stream to be closed")
+	}
+	res.Body.Close()
+
+	ts.Close()
+	store.Close()
+
+	// Every goroutine started by the server and store should exit
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > baseline {
+		buf := make([]byte, 1<<16)
+		t.Errorf("Got %d goroutines, want %d\n%s", got, baseline, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestShutdownRejectsConnections(t *testing.T) {
+	server, _ := newTestServer(t)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	w := httptest.NewRecorder()
+	server.HandleEvents(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
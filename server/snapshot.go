@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	core "scritti/core"
+)
+
+// SnapshotData names a snapshot of the project
+type SnapshotData struct {
+	Name string `json:"name"`
+}
+
+// DiffData names the snapshots to compare, an empty To compares against the
+// working copy
+type DiffData struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// snapshotAction saves the working copy as a named snapshot
+func (p ComponentServer) snapshotAction(request JsonRpcRequest) JsonRpcResponse {
+	var data SnapshotData
+	json.Unmarshal([]byte(request.Params), &data)
+	log.Printf("Snapshot: %q\n", data.Name)
+
+	snapshot, err := p.store.SaveSnapshot(data.Name)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  snapshot,
+		ID:      request.ID,
+	}
+}
+
+// snapshotsAction lists the names of saved snapshots
+func (p ComponentServer) snapshotsAction(request JsonRpcRequest) JsonRpcResponse {
+	names, err := p.store.ListSnapshots()
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  names,
+		ID:      request.ID,
+	}
+}
+
+// diffAction compares two snapshots, or a snapshot and the working copy
+func (p ComponentServer) diffAction(request JsonRpcRequest) JsonRpcResponse {
+	var data DiffData
+	json.Unmarshal([]byte(request.Params), &data)
+	log.Printf("Diff: %q to %q\n", data.From, data.To)
+
+	from, err := p.store.LoadSnapshot(data.From)
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	var to core.Snapshot
+	if len(data.To) > 0 {
+		to, err = p.store.LoadSnapshot(data.To)
+	} else {
+		to, err = p.store.TakeSnapshot()
+	}
+	if err != nil {
+		return makeError(request.ID, err)
+	}
+
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  core.Diff(from, to),
+		ID:      request.ID,
+	}
+}
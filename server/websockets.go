@@ -1,7 +1,6 @@
 package server
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +9,7 @@ import (
 	"regexp"
 	core "scritti/core"
 	"strings"
+	"sync"
 
 	"golang.org/x/net/websocket"
 )
@@ -20,92 +20,180 @@ func isWebsocketRequest(req *http.Request) bool {
 	return connectionUpgradeRegex.MatchString(strings.ToLower(req.Header.Get("Connection"))) && strings.ToLower(req.Header.Get("Upgrade")) == "websocket"
 }
 
+// AssetData is the state of an asset sent to clients. Version identifies the
+// asset source, and Hash the rendered HTML, changing with the source of the
+// component or any asset it renders so clients can cache the HTML by it
 type AssetData struct {
-	ID     core.AssetKey `json:"id"`
-	Source string        `json:"source"`
-	HTML   string        `json:"html"`
+	ID      core.AssetKey `json:"id"`
+	Source  string        `json:"source"`
+	HTML    string        `json:"html"`
+	Version string        `json:"version,omitempty"`
+	Hash    string        `json:"hash,omitempty"`
 }
 
-// makeError returns the appropriate JSON RPC Error for an error type
-func makeError(id int, err error) JsonRpcResponse {
-	var errorDetail *JsonRpcError
-
-	switch err.(type) {
+// makeErrorDetail returns the appropriate JSON RPC Error for an error type
+func makeErrorDetail(err error) *JsonRpcError {
+	switch v := err.(type) {
 	case *core.AssetNotFound:
-		errorDetail = &JsonRpcError{
+		return &JsonRpcError{
 			Code:    1,
 			Message: err.Error(),
 		}
+	case *core.ConflictError:
+		return &JsonRpcError{
+			Code:    2,
+			Message: err.Error(),
+			Data: &AssetData{
+				ID:      v.Key,
+				Source:  v.Content,
+				Version: v.Version,
+			},
+		}
 	default:
-		errorDetail = &JsonRpcError{
+		return &JsonRpcError{
 			Code:    0,
 			Message: err.Error(),
 		}
 	}
+}
 
+// makeError returns the appropriate JSON RPC Error response for an error type
+func makeError(id int, err error) JsonRpcResponse {
 	return JsonRpcResponse{
 		JSONRPC: "2.0",
-		Error:   errorDetail,
+		Error:   makeErrorDetail(err),
 		ID:      id,
 	}
 }
 
-func (p ComponentServer) pushLoop(ws *websocket.Conn, done <-chan bool) {
-	key := core.AssetKey{AssetType: core.ComponentType, Name: "main"}
+// makeErrorNotification returns a JSON RPC notification reporting an error
+// with an asset the client is subscribed to
+func makeErrorNotification(key core.AssetKey, err error) JsonRpcNotification {
+	detail := makeErrorDetail(err)
+	detail.Data = key
+	return JsonRpcNotification{
+		JSONRPC: "2.0",
+		Method:  "error",
+		Params:  detail,
+	}
+}
 
-	for range p.store.Watch(key, done) {
-		log.Println("hot reloading!")
-		asset, err := p.store.Get(key)
+// renderAsset returns the current state of an asset, rendering Components to HTML
+func (p ComponentServer) renderAsset(key core.AssetKey) (*AssetData, error) {
+	asset, version, err := p.store.GetVersion(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := asset.(type) {
+	case core.Component:
+		html, hash, err := p.store.Render(key)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		component := asset.(core.Component)
+		return &AssetData{
+			ID:      key,
+			Source:  v.Source,
+			HTML:    html,
+			Version: version,
+			Hash:    hash,
+		}, nil
+	case core.Style:
+		return &AssetData{
+			ID:      key,
+			Source:  v.Source,
+			Version: version,
+		}, nil
+	case core.SVG:
+		return &AssetData{
+			ID:      key,
+			Source:  v.Source,
+			Version: version,
+		}, nil
+	}
 
-		// Render output
-		buffer := new(bytes.Buffer)
-		err = core.RenderComponent(buffer, asset.(core.Component), p.store.Get)
-		if err != nil {
-			log.Fatal(err)
+	return nil, fmt.Errorf("Can't convert %d %q", key.AssetType, key.Name)
+}
+
+func (p ComponentServer) pushLoop(ws *websocket.Conn, done <-chan bool) {
+	key := core.AssetKey{AssetType: core.ComponentType, Name: "main"}
+
+	watch, err := p.store.Watch(key, done)
+	if err != nil {
+		log.Printf("Unable to watch %q, %v\n", key.Name, err)
+		if err := websocket.JSON.Send(ws, makeErrorNotification(key, err)); err != nil {
+			log.Println("message not sent " + err.Error())
 		}
+		return
+	}
 
-		data := AssetData{
-			ID:     core.AssetKey{0, "main"},
-			Source: component.Source,
-			HTML:   buffer.String(),
+	for range watch {
+		log.Println("hot reloading!")
+		var message interface{}
+		data, err := p.renderAsset(key)
+		if err != nil {
+			log.Printf("Unable to render %q, %v\n", key.Name, err)
+			message = makeErrorNotification(key, err)
+		} else {
+			message = data
 		}
 
-		err = websocket.JSON.Send(ws, data)
+		err = websocket.JSON.Send(ws, message)
 		if err != nil {
 			log.Println("message not sent " + err.Error())
 			break
 		}
 		log.Println("done reload")
 	}
+
+	// The store ends subscriptions that fall too far behind, close the
+	// connection so the client reconnects and resyncs
+	select {
+	case <-done:
+	default:
+		log.Printf("Subscription to %q ended, closing connection", key.Name)
+		ws.Close()
+	}
 }
 
-func (p ComponentServer) setAction(request JsonRpcRequest) JsonRpcResponse {
+func (p ComponentServer) setAction(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
 	var data AssetData
 	json.Unmarshal([]byte(request.Params), &data)
 	log.Printf("Set: %q\n", data)
-	err := p.store.Set(data.ID, data.Source)
 
-	if err != nil {
-		return JsonRpcResponse{
-			JSONRPC: "2.0",
-			Error: &JsonRpcError{
-				Code:    1,
-				Message: err.Error(),
-			},
-			ID: request.ID,
+	var err error
+	doc := p.documents.get(data.ID)
+	if len(data.Version) > 0 {
+		// Only overwrite the version of the asset the client last saw, then
+		// bring any document being edited up to date
+		err = p.store.SetIfVersionAs(data.ID, data.Source, data.Version, p.hub.author(ws))
+		if err == nil && doc != nil {
+			if err := doc.reset(data.Source); err != nil {
+				log.Printf("Unable to reset document %q, %v\n", data.ID.Name, err)
+			}
 		}
+	} else if doc != nil {
+		// Replace the source of documents being edited as an operation, so
+		// other clients can transform their pending edits
+		doc.mu.Lock()
+		operation, version := core.NewReplaceOperation(doc.source, data.Source), doc.version
+		doc.mu.Unlock()
+		_, err = p.edit(doc, ws, version, operation)
+	} else {
+		err = p.store.SetAs(data.ID, data.Source, p.hub.author(ws))
+	}
+
+	if err != nil {
+		return makeError(request.ID, err)
 	}
 
 	return JsonRpcResponse{
 		JSONRPC: "2.0",
 		Result: &AssetData{
-			ID:     data.ID,
-			Source: data.Source,
-			HTML:   data.HTML,
+			ID:      data.ID,
+			Source:  data.Source,
+			HTML:    data.HTML,
+			Version: core.ContentVersion(data.Source),
 		},
 		ID: request.ID,
 	}
@@ -116,55 +204,15 @@ func (p ComponentServer) getAction(request JsonRpcRequest) JsonRpcResponse {
 	json.Unmarshal([]byte(request.Params), &key)
 	log.Printf("Get: %q\n", key)
 
-	buffer := new(bytes.Buffer)
-
-	asset, err := p.store.Get(key)
+	data, err := p.renderAsset(key)
 	if err != nil {
 		return makeError(request.ID, err)
 	}
 
-	switch v := asset.(type) {
-	case core.Component:
-		err = core.RenderComponent(buffer, v, p.store.Get)
-		if err != nil {
-			log.Fatal(err)
-		}
-		return JsonRpcResponse{
-			JSONRPC: "2.0",
-			Result: &AssetData{
-				ID:     key,
-				Source: v.Source,
-				HTML:   buffer.String(),
-			},
-			ID: request.ID,
-		}
-	case core.Style:
-		return JsonRpcResponse{
-			JSONRPC: "2.0",
-			Result: &AssetData{
-				ID:     key,
-				Source: v.Source,
-			},
-			ID: request.ID,
-		}
-	case core.SVG:
-		return JsonRpcResponse{
-			JSONRPC: "2.0",
-			Result: &AssetData{
-				ID:     key,
-				Source: v.Source,
-			},
-			ID: request.ID,
-		}
-	}
-
 	return JsonRpcResponse{
 		JSONRPC: "2.0",
-		Error: &JsonRpcError{
-			Code:    1,
-			Message: fmt.Sprintf("Can't convert %d %q", key.AssetType, key.Name),
-		},
-		ID: request.ID,
+		Result:  data,
+		ID:      request.ID,
 	}
 }
 
@@ -180,7 +228,56 @@ func (p ComponentServer) listAction(request JsonRpcRequest) JsonRpcResponse {
 	}
 }
 
-func (p ComponentServer) rpcLoop(ws *websocket.Conn) {
+// metricsAction reports the size of the store and its evictions
+func (p ComponentServer) metricsAction(request JsonRpcRequest) JsonRpcResponse {
+	return JsonRpcResponse{
+		JSONRPC: "2.0",
+		Result:  p.store.Metrics(),
+		ID:      request.ID,
+	}
+}
+
+// dispatch routes a JSON RPC request from a socket, or nil for plain HTTP
+// requests, to the action for its method
+func (p ComponentServer) dispatch(request JsonRpcRequest, ws *websocket.Conn) JsonRpcResponse {
+	switch request.Method {
+	case "set":
+		return p.setAction(request, ws)
+	case "open":
+		return p.openAction(request, ws)
+	case "edit":
+		return p.editAction(request, ws)
+	case "presence":
+		return p.presenceAction(request, ws)
+	case "history":
+		return p.historyAction(request)
+	case "undo":
+		return p.undoAction(request, ws, p.store.UndoAs)
+	case "redo":
+		return p.undoAction(request, ws, p.store.RedoAs)
+	case "revert":
+		return p.revertAction(request, ws)
+	case "snapshot":
+		return p.snapshotAction(request)
+	case "snapshots":
+		return p.snapshotsAction(request)
+	case "diff":
+		return p.diffAction(request)
+	case "get":
+		return p.getAction(request)
+	case "list":
+		return p.listAction(request)
+	case "metrics":
+		return p.metricsAction(request)
+	}
+
+	log.Println("Unknown request method", request)
+	return makeError(request.ID, fmt.Errorf("Unknown request method %q", request.Method))
+}
+
+// rpcLoop serves rpc calls until the socket closes, holding busy while a call
+// is in flight
+func (p ComponentServer) rpcLoop(ws *websocket.Conn, busy *sync.Mutex) {
 	for {
 		var request JsonRpcRequest
 		err := websocket.JSON.Receive(ws, &request)
@@ -193,24 +290,11 @@ func (p ComponentServer) rpcLoop(ws *websocket.Conn) {
 			break
 		}
 
-		var response JsonRpcResponse
-
-		switch request.Method {
-		case "set":
-			response = p.setAction(request)
-
-		case "get":
-			response = p.getAction(request)
-
-		case "list":
-			response = p.listAction(request)
-
-		default:
-			response = makeError(request.ID, fmt.Errorf("Unknown request method %q", request.Method))
-			log.Println("Unknown request method", request)
-		}
+		busy.Lock()
+		response := p.dispatch(request, ws)
 
 		err = websocket.JSON.Send(ws, &response)
+		busy.Unlock()
 		if err != nil {
 			log.Println("Message not sent " + err.Error())
 			break
@@ -221,22 +305,51 @@ func (p ComponentServer) rpcLoop(ws *websocket.Conn) {
 
 // handleWebSockets manages rpc calls and push notifications for a socket
 func (p ComponentServer) handleWebSockets(ws *websocket.Conn) {
+	if !p.connections.add() {
+		return
+	}
+	defer p.connections.done()
+
 	done := make(chan bool)
+	var busy sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(2)
 
+	p.hub.join(ws)
 	log.Println("Connection established by " + ws.RemoteAddr().String())
 
 	// Push loop
-	go p.pushLoop(ws, done)
+	go func() {
+		p.pushLoop(ws, done)
+		wg.Done()
+	}()
+
+	// Close the socket on shutdown, once any in-flight rpc call has completed
+	go func() {
+		select {
+		case <-p.connections.closing:
+			busy.Lock()
+			ws.Close()
+			busy.Unlock()
+		case <-done:
+		}
+		wg.Done()
+	}()
 
 	// RPC loop
-	p.rpcLoop(ws)
+	p.rpcLoop(ws, &busy)
 
-	log.Println("Socket disconnected by user")
+	log.Println("Socket disconnected")
+	p.documents.leave(ws)
+	p.hub.leave(ws)
 	close(done)
+	wg.Wait()
 }
 
 func (p ComponentServer) HandleHotReload(w http.ResponseWriter, r *http.Request) {
-	if isWebsocketRequest(r) {
-		websocket.Handler(p.handleWebSockets).ServeHTTP(w, r)
+	if !isWebsocketRequest(r) {
+		http.Error(w, "Expected WebSocket upgrade, use /events and /rpc instead", http.StatusUpgradeRequired)
+		return
 	}
+	websocket.Handler(p.handleWebSockets).ServeHTTP(w, r)
 }
@@ -1 +1,108 @@
 package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	core "scritti/core"
+	"scritti/filesystem"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestGetAction(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	t.Run("Test get missing asset", func(t *testing.T) {
+		response := server.getAction(JsonRpcRequest{
+			JSONRPC: "2.0",
+			Method:  "get",
+			Params:  json.RawMessage(`{"assetType":0,"name":"missing"}`),
+			ID:      1,
+		})
+
+		if response.Error == nil {
+			t.Fatal("Expected error")
+		}
+		if response.Error.Code != 1 {
+			t.Errorf("Got error code %d, want 1", response.Error.Code)
+		}
+	})
+
+	t.Run("Test render hash", func(t *testing.T) {
+		key := core.AssetKey{AssetType: core.ComponentType, Name: "main"}
+		before, err := server.renderAsset(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before.Hash) == 0 || before.Hash == before.Version {
+			t.Fatalf("Got hash %q, want the hash of the rendered assets", before.Hash)
+		}
+
+		// Changing a style changes the HTML but not the component version
+		if err := server.store.Set(core.AssetKey{AssetType: core.StyleType, Name: "root"}, "class3"); err != nil {
+			t.Fatal(err)
+		}
+		after, err := server.renderAsset(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Version != before.Version {
+			t.Errorf("Got version %q, want %q", after.Version, before.Version)
+		}
+		if after.Hash == before.Hash {
+			t.Errorf("Got unchanged hash %q after style change", after.Hash)
+		}
+
+		again, err := server.renderAsset(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Hash != after.Hash {
+			t.Errorf("Got hash %q, want %q", again.Hash, after.Hash)
+		}
+	})
+}
+
+func TestPushLoop(t *testing.T) {
+	t.Run("Test error notification for missing asset", func(t *testing.T) {
+		store := core.NewFileStore(filesystem.NewMemoryFileSystem(), "")
+		defer store.Close()
+		server := NewComponentServer(store)
+		ts := httptest.NewServer(http.HandlerFunc(server.HandleHotReload))
+		defer ts.Close()
+
+		url := "ws" + strings.TrimPrefix(ts.URL, "http")
+		ws, err := websocket.Dial(url, "", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var notification struct {
+			Method string       `json:"method"`
+			Params JsonRpcError `json:"params"`
+		}
+		if err := websocket.JSON.Receive(ws, &notification); err != nil {
+			t.Fatal(err)
+		}
+		if notification.Method != "error" {
+			t.Errorf("Got method %q, want error", notification.Method)
+		}
+
+		// The connection should remain usable for rpc calls
+		err = websocket.JSON.Send(ws, JsonRpcRequest{JSONRPC: "2.0", Method: "list", ID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response JsonRpcResponse
+		if err := websocket.JSON.Receive(ws, &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.ID != 1 {
+			t.Errorf("Got id %d, want 1", response.ID)
+		}
+	})
+}
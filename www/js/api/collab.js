@@ -0,0 +1,110 @@
+import { store } from 'https://unpkg.com/hybrids@latest/src/index.js';
+import AssetStore from '../store/asset-store.js';
+import ws from './ws.js'
+
+// Collaborative editing, sending buffer changes as operations against the
+// last known server version of an asset
+export default (function() {
+    // Last known server state of each open asset, by store id
+    const documents = new Map();
+
+    // Asset and selection of other connected clients, by client id
+    const peers = new Map();
+
+    const storeId = (assetKey) => [assetKey.assetType, assetKey.name].join(' ')
+
+    // Operations count characters as code points, matching the server
+    const diff = (source, target) => {
+        const a = Array.from(source)
+        const b = Array.from(target)
+        let prefix = 0
+        while (prefix < a.length && prefix < b.length && a[prefix] === b[prefix]) {
+            prefix++
+        }
+        let suffix = 0
+        while (suffix < a.length - prefix && suffix < b.length - prefix &&
+            a[a.length - 1 - suffix] === b[b.length - 1 - suffix]) {
+            suffix++
+        }
+        const insert = b.slice(prefix, b.length - suffix).join('')
+        const remove = a.length - prefix - suffix
+        return [
+            prefix && { retain: prefix },
+            insert && { insert },
+            remove && { delete: remove },
+            suffix && { retain: suffix },
+        ].filter(Boolean)
+    }
+
+    const apply = (source, operation) => {
+        const text = Array.from(source)
+        let result = ''
+        let i = 0
+        operation.forEach(op => {
+            if (op.retain) {
+                result += text.slice(i, i + op.retain).join('')
+                i += op.retain
+            } else if (op.insert) {
+                result += op.insert
+            } else if (op.delete) {
+                i += op.delete
+            }
+        })
+        return result
+    }
+
+    const open = async (assetKey) => {
+        const result = await ws.send('open', assetKey)
+        documents.set(storeId(assetKey), result)
+        return result
+    }
+
+    // Send the change from the last known server source to source
+    const edit = async (assetKey, source) => {
+        const doc = documents.get(storeId(assetKey)) || await open(assetKey)
+        const result = await ws.send('edit', {
+            id: assetKey,
+            version: doc.version,
+            operation: diff(doc.source, source),
+        })
+        documents.set(storeId(assetKey), result)
+        return result
+    }
+
+    // Apply edits from other clients, resynchronising on a missed version
+    ws.subscribe('edit', ({ id, version, operation }) => {
+        const doc = documents.get(storeId(id))
+        if (doc && doc.version + 1 === version) {
+            documents.set(storeId(id), {
+                id,
+                version,
+                source: apply(doc.source, operation),
+            })
+        } else {
+            documents.delete(storeId(id))
+        }
+        store.clear(store.get(AssetStore, storeId(id)))
+    })
+
+    // Share the asset and selection of this client, selection offsets are code points
+    const presence = async (assetKey, selection) => {
+        const others = await ws.send('presence', { id: assetKey, selection })
+        peers.clear()
+        others.forEach(peer => peers.set(peer.client, peer))
+    }
+
+    ws.subscribe('presence', (peer) => {
+        if (peer.id) {
+            peers.set(peer.client, peer)
+        } else {
+            peers.delete(peer.client)
+        }
+    })
+
+    return {
+        open,
+        edit,
+        presence,
+        peers
+    }
+}())
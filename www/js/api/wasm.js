@@ -29,10 +29,8 @@ export default (function(){
         )
         go.run(result.instance)
 
-        const data = await fetch("www/export.json")
-        const assets = await data.json()
-
-        await Promise.all(assets.map(asset => send('set', {id: asset.id, source: asset.source})))
+        // The WASM module loads the bundle at scrittiBundle, or www/export.json
+        await scrittiReady
 
         const asset = store.get(AssetStore, "0 main");
         store.clear(asset);
@@ -5,8 +5,14 @@ export default (function() {
     let id = 0;
     let socket;
     const promises = new Map();
+    const listeners = new Map();
+
+    let events;
 
     const send = (method, params) => {
+        if (events) {
+            return post(method, params)
+        }
         return new Promise((resolve, reject) => {
             const request = {
                 jsonrpc: "2.0",
@@ -27,6 +33,41 @@ export default (function() {
         })
     };
 
+    // Fallback for when WebSocket upgrades are unavailable, RPC over plain HTTP POST
+    const post = async (method, params) => {
+        const request = {
+            jsonrpc: "2.0",
+            method,
+            params,
+            id: ++id,
+        }
+        console.log(`Posting`, request)
+        const response = await fetch(window.origin + '/rpc', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(request),
+        }).then(r => r.json())
+        console.log(`Received`, response)
+        if (response.error) {
+            throw response.error
+        }
+        return response.result
+    };
+
+    // Subscribe to JSON RPC notifications of a method
+    const subscribe = (method, fn) => {
+        if (!listeners.has(method)) {
+            listeners.set(method, [])
+        }
+        listeners.get(method).push(fn)
+    };
+
+    const clearAsset = (response) => {
+        const id = [response.id.assetType, response.id.name].join(' ') 
+        const asset = store.get(AssetStore, id)
+        store.clear(asset)
+    };
+
     const socketMessageListener = (e) => {
         const response = JSON.parse(e.data)
         console.log(`Received`, response)
@@ -41,15 +82,21 @@ export default (function() {
                     prom.resolve(response.result)
                 }
                 promises.delete(response.id)
+            } else if (listeners.has(response.method)) {
+                listeners.get(response.method).forEach(fn => fn(response.params))
             } else {
                 console.error(response)
             }
         } else {
-            const id = [response.id.assetType, response.id.name].join(' ') 
-            const asset = store.get(AssetStore, id)
-            store.clear(asset)
+            clearAsset(response)
         }
     };
+
+    const eventMessageListener = (e) => {
+        const response = JSON.parse(e.data)
+        console.log(`Received`, response)
+        clearAsset(response)
+    };
     
     const socketCloseListener = (e) => {
         if (socket) {
@@ -57,21 +104,51 @@ export default (function() {
         }
     };
 
-    const initialize = () => {
+    const connectSocket = () => {
         const url = window.origin.replace("http", "ws") + '/ws';
         return new Promise((resolve, reject) => {
             socket = new WebSocket(url);
             socket.onopen = resolve;
             socket.onmessage = socketMessageListener;
             socket.onerror = (e) => {
+                socket = undefined;
                 reject();
             }
             socket.onclose = socketCloseListener;
         });
     };
 
+    const connectEvents = () => {
+        const url = window.origin + '/events?asset=main';
+        return new Promise((resolve, reject) => {
+            const source = new EventSource(url);
+            source.onopen = () => {
+                events = source;
+                resolve();
+            };
+            source.onmessage = eventMessageListener;
+            source.addEventListener('asset-error', (e) => console.error(JSON.parse(e.data)));
+            source.onerror = (e) => {
+                if (!events) {
+                    source.close();
+                    reject();
+                }
+            }
+        });
+    };
+
+    const initialize = async () => {
+        try {
+            await connectSocket()
+        } catch (ex) {
+            console.info('WebSocket unavailable, falling back to Server-Sent Events');
+            await connectEvents()
+        }
+    };
+
     return {
         initialize,
-        send
+        send,
+        subscribe
     }
 }())
\ No newline at end of file
@@ -1,5 +1,7 @@
 import { define, dispatch, html, store } from 'https://unpkg.com/hybrids@latest/src/index.js';
 import AssetStore from './store/asset-store.js';
+import ApplicationStore from './store/application-store.js';
+import collab from './api/collab.js';
 
 async function selectLines(host) {
   // const source = host.shadowRoot.querySelector('textarea').value.split("\n")
@@ -21,9 +23,21 @@ function updateLine(host, target) {
       host.focusedLines = Array(endLine - startLine + 1)
         .fill(startLine - 1)
         .map((v, i) => v + i)
+      sharePresence(host, target)
     }, 1)
 }
 
+function sharePresence(host, target) {
+  if (!store.get(ApplicationStore).server) {
+    return
+  }
+  const offset = (i) => Array.from(target.value.substr(0, i)).length
+  collab.presence(
+    { assetType: Number(host.assetType), name: host.assetName },
+    { anchor: offset(target.selectionStart), head: offset(target.selectionEnd) }
+  ).catch(ex => console.error('presence:', ex))
+}
+
 function handleMouseDown(host, e) {
   updateLine(host, e.target)
 }
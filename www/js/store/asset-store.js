@@ -1,6 +1,7 @@
 import { store } from 'https://unpkg.com/hybrids@latest/src/index.js';
 import wasm from '../api/wasm.js';
 import ws from '../api/ws.js'
+import collab from '../api/collab.js'
 import ApplicationStore from './application-store.js';
 
 const sleep = (milliseconds) => {
@@ -43,7 +44,10 @@ const AssetStore = {
             let result;
 
             if (app.server) {
-                result = await ws.send('set', data);
+                result = {
+                    ...values,
+                    ...await collab.edit(data.id, values.source),
+                };
             } else {
                 result = await wasm.send('set', data);
                 // TODO: Temporary workaround until 'hot reload' functionality built for WASM
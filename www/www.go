@@ -0,0 +1,9 @@
+// Package www holds the IDE web assets, embedded into the scritti binary
+package www
+
+import "embed"
+
+// Files are the web assets served by the IDE
+//
+//go:embed index.html export.json lib.wasm wasm_exec.js js
+var Files embed.FS